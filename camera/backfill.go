@@ -0,0 +1,166 @@
+package camera
+
+import (
+	"errors"
+	"github.com/greendrake/cctv/dvr"
+	"github.com/greendrake/cctv/muxer/ebml/matroska"
+	"io"
+	"log"
+	"slices"
+	"time"
+)
+
+const (
+	backfillInterval = time.Hour
+	// Shorter gaps (e.g. between chunks, or while the stream reconnects) are not worth filling
+	minBackfillGap = time.Minute
+	// The latest footage is left alone, as the device may be still writing it
+	backfillGuard = 10 * time.Minute
+)
+
+// gap is a time range with no local recording
+type gap struct {
+	from time.Time
+	to   time.Time
+}
+
+// canBackfill tells whether the backfill can work: it fills the continuous recording of the main stream over DVRIP
+func (c *Camera) canBackfill() bool {
+	return c.index != nil && slices.Contains(c.Save, StreamMain) && c.streamUsesDVRIP(StreamMain) &&
+		c.getRecordConfig(StreamMain).RecordMode == RecordContinuous
+}
+
+// maybeBackfill starts filling the gaps in the recordings if it is time to, starting right away
+func (c *Camera) maybeBackfill(now time.Time) {
+	if c.Backfill <= 0 || now.Before(c.nextBackfill) || c.backfilling.Load() {
+		return
+	}
+	c.nextBackfill = now.Add(backfillInterval)
+	if !c.canBackfill() {
+		return
+	}
+	c.backfilling.Store(true)
+	go func() {
+		defer c.backfilling.Store(false)
+		c.backfill(now)
+	}()
+}
+
+// backfill fills the gaps in the recordings of the main stream within Backfill with the files recorded on the device
+func (c *Camera) backfill(now time.Time) {
+	gaps, err := c.findGaps(now.Add(-c.Backfill), now.Add(-backfillGuard), now)
+	if err != nil {
+		log.Printf("%v: cannot find gaps in the recordings: %v", c.GetNode().ID, err)
+		return
+	}
+	for _, g := range gaps {
+		var files []*dvrip.RecordFile
+		err := c.withDVRIP(func(client *dvrip.Client) error {
+			files, err = client.FileQuery(c.Channel, g.from.In(c.clockZone), g.to.In(c.clockZone))
+			return err
+		})
+		if err != nil {
+			log.Printf("%v: cannot list the recordings on the device: %v", c.GetNode().ID, err)
+			return
+		}
+		for _, f := range files {
+			if c.Node.Ctx.Err() != nil {
+				return
+			}
+			if c.backfilled[f.Name] {
+				continue
+			}
+			if err = c.backfillFile(f, g); err != nil {
+				log.Printf("%v: cannot backfill from %v: %v", c.GetNode().ID, f.Name, err)
+				continue
+			}
+			c.backfilled[f.Name] = true
+		}
+	}
+}
+
+// findGaps returns the gaps in the recordings of the main stream within [from, to). Open recordings last until now.
+func (c *Camera) findGaps(from time.Time, to time.Time, now time.Time) ([]gap, error) {
+	recs, err := c.index.Query(string(c.Name), StreamID2String(StreamMain), from, to)
+	if err != nil {
+		return nil, err
+	}
+	var gaps []gap
+	cursor := from
+	for _, r := range recs {
+		if r.Start.Sub(cursor) >= minBackfillGap {
+			gaps = append(gaps, gap{cursor, r.Start})
+		}
+		end := r.End
+		if r.IsOpen() {
+			end = now
+		}
+		if end.After(cursor) {
+			cursor = end
+		}
+	}
+	if to.Sub(cursor) >= minBackfillGap {
+		gaps = append(gaps, gap{cursor, to})
+	}
+	return gaps, nil
+}
+
+// backfillFile downloads the file from the device and writes its part within the gap into the recordings
+func (c *Camera) backfillFile(f *dvrip.RecordFile, g gap) error {
+	ctx := c.Node.Ctx
+	session, err := dvrip.AcquireSession(ctx, c.Address, c.User, c.Password)
+	if err != nil {
+		return err
+	}
+	d, err := session.Download(ctx, c.Channel, f, &dvrip.Clock{
+		Name:     c.GetNode().ID,
+		Location: c.clockZone,
+		Stamp:    true,
+		Past:     true,
+	})
+	if err != nil {
+		session.Release()
+		return err
+	}
+	defer d.Close()
+	w := &MKVWriter{
+		dstDir:      c.dstDir,
+		HasAudio:    c.HasAudio,
+		audio:       d.AudioFormat(),
+		FileSuff:    StreamID2String(StreamMain),
+		ChunkConfig: c.getChunkConfig(StreamMain),
+		index:       c.index,
+		camName:     string(c.Name),
+		tags:        append(c.mkvTags(StreamMain, "DVRIP"), matroska.Tag{Name: "SOURCE_FILE", Value: f.Name}),
+	}
+	defer w.close()
+	writing := false
+	for ctx.Err() == nil {
+		fr, err := d.GetFrame()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if fr.IsVideo {
+			if !fr.Time.Before(g.to) {
+				break
+			}
+			// Starting with a key frame within the gap
+			if !writing && (!fr.IsVideoKeyFrame || fr.Time.Before(g.from)) {
+				continue
+			}
+			if !writing {
+				log.Printf("%v: backfilling %v from %v", c.GetNode().ID, f.Name, fr.Time.Format(time.DateTime))
+			}
+			writing = true
+		} else if !writing || !fr.IsAudio {
+			continue
+		}
+		if err = w.writeFrame(fr); err != nil {
+			return err
+		}
+	}
+	return ctx.Err()
+}
@@ -3,12 +3,19 @@ package camera
 import (
 	"context"
 	"fmt"
+	"github.com/greendrake/cctv/event"
+	"github.com/greendrake/cctv/onvif"
+	"github.com/greendrake/cctv/recindex"
+	"github.com/greendrake/cctv/retention"
+	"github.com/greendrake/cctv/rtsp"
 	"github.com/greendrake/cctv/util"
 	"github.com/greendrake/server_client_hierarchy"
 	"log"
 	"net"
 	"slices"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,8 +29,43 @@ const (
 )
 
 type StreamConfig struct {
-	ID      StreamID
-	UseRTSP bool
+	ID            StreamID
+	UseRTSP       bool
+	Source        string           `yaml:"Source"`        // Overrides the camera's source for this stream
+	RTSPURL       string           `yaml:"RTSPURL"`       // Overrides the camera's RTSP URL template for this stream
+	RTSPTransport string           `yaml:"RTSPTransport"` // Overrides the camera's RTSP transport for this stream
+	ChunkConfig   `yaml:",inline"` // Overrides the camera's chunk configuration for this stream
+	RecordConfig  `yaml:",inline"` // Overrides the camera's record configuration for this stream
+}
+
+// ChunkConfig defines when MKV files are split into chunks. A split always happens on a key frame.
+type ChunkConfig struct {
+	ChunkDuration time.Duration `yaml:"ChunkDuration"` // 10 minutes by default
+	MaxChunkSize  util.ByteSize `yaml:"MaxChunkSize"`  // Split earlier if the file grows this big. No limit by default
+	// Split on wall-clock multiples of ChunkDuration (e.g. :00, :10, :20 for 10m) so that files of all cameras line up
+	AlignChunks bool `yaml:"AlignChunks"`
+}
+
+// Record modes
+const (
+	RecordContinuous = "continuous"
+	RecordEvents     = "events"
+	RecordSchedule   = "schedule"
+)
+
+const defaultEventRoll = 10 * time.Second
+
+// RecordConfig defines what gets recorded of the streams in Save
+type RecordConfig struct {
+	// continuous (default), events or schedule. In the events mode, only clips around the events of the camera are recorded.
+	// In the schedule mode, the stream is recorded continuously within the windows of Schedule.
+	RecordMode string    `yaml:"RecordMode"`
+	Schedule   *Schedule `yaml:"Schedule"`
+	// Events mode: how much to record before an event (from the key frame before) and after it ends. 10s by default
+	PreRoll  time.Duration `yaml:"PreRoll"`
+	PostRoll time.Duration `yaml:"PostRoll"`
+	// Detect motion by the growth of the video bit rate, for cameras that do not report it themselves
+	MotionHeuristic bool `yaml:"MotionHeuristic"`
 }
 
 // This struct is read into from JSON by jsonconfig.
@@ -34,17 +76,91 @@ type Camera struct {
 	Address  string         `yaml:"Address"`
 	User     string         `yaml:"User"`
 	Password string         `yaml:"Password"`
-	Type     CamType        `yaml:"Type"` // DVR assumed by default. Can be BITVISION
+	Type     CamType        `yaml:"Type"` // DVR assumed by default. Can be BITVISION or ONVIF
 	UseRTSP  bool           `yaml:"UseRTSP"`
 	HasAudio bool           `yaml:"HasAudio"`
 	Streams  []StreamConfig `yaml:"Streams"`
 	Save     []StreamID     `yaml:"Save"`    // Streams to save to files
 	WebCast  []StreamID     `yaml:"WebCast"` // Streams to broadcast via MSE
+	// Where the video comes from: dvrip or rtsp, or any source registered with RegisterSource.
+	// dvrip by default, rtsp if UseRTSP or if Type has no DVRIP. Can be overridden per stream.
+	Source string `yaml:"Source"`
+	// Options of the source, as it defines them (the built-in ones have none)
+	SourceOptions map[string]string `yaml:"SourceOptions"`
+	// Chunk configuration for all streams of the camera. Can be overridden per stream.
+	ChunkConfig `yaml:",inline"`
+	// Record configuration for all streams of the camera. Can be overridden per stream.
+	RecordConfig `yaml:",inline"`
+	// Per-camera retention limits. MaxAge overrides the global one; the others apply on top of the global ones.
+	Retention retention.Policy `yaml:"Retention"`
+	// DVRIP only: time-stamp recordings by the camera's own clock (as shown on its overlay) rather than the host's
+	UseCameraClock bool `yaml:"UseCameraClock"`
+	// Time zone of the camera's clock, e.g. "Pacific/Auckland". The host's one by default
+	CameraTimeZone string `yaml:"CameraTimeZone"`
+	// DVRIP only: log when the camera and host clocks diverge more than this. 5s by default
+	MaxClockDrift time.Duration `yaml:"MaxClockDrift"`
+	// DVRIP only: set the camera clock to the host one (in CameraTimeZone) this often. Off by default
+	ClockSyncInterval time.Duration `yaml:"ClockSyncInterval"`
+	// RTSP URL template with placeholders: {user}, {password}, {address}, {port}, {channel}, {channel0}, {stream}.
+	// The default one depends on Type. Can be overridden per stream.
+	RTSPURL string `yaml:"RTSPURL"`
+	// 554 by default
+	RTSPPort int `yaml:"RTSPPort"`
+	// ONVIF only: URL of the device service. http://<Address>/onvif/device_service by default
+	ONVIFURL string `yaml:"ONVIFURL"`
+	// RTSP transport: udp, tcp or multicast. Automatic (UDP, falling back to TCP) by default. Can be overridden per stream.
+	RTSPTransport string `yaml:"RTSPTransport"`
+	// Channel number (0-based) on a multi-channel device such as an NVR. Each channel is configured as a camera
+	// of its own (and so recorded into its own directory); over DVRIP, the cameras of one device share its login.
+	Channel int `yaml:"Channel"`
+	// DVRIP only: archive a snapshot (JPEG) this often into the snapshots directory of the camera. Off by default
+	SnapshotInterval time.Duration `yaml:"SnapshotInterval"`
+	// Delete the archived snapshots older than this. 7 days by default
+	SnapshotMaxAge time.Duration `yaml:"SnapshotMaxAge"`
+	// DVRIP only: look this far back for gaps in the recordings of the main stream (e.g. while the host was down),
+	// and fill them with the files recorded on the device (e.g. on its SD card). Off by default
+	Backfill time.Duration `yaml:"Backfill"`
 	// YAML fields end
 
 	server_client_hierarchy.Node
 	dstDir     string
+	index      *recindex.Index
+	events     *event.Bus
 	IsDisabled bool
+	clockZone  *time.Location
+	// Tell the streams recorded in the events mode when to record
+	triggers map[StreamID]*eventTrigger
+	// Of the streams recorded in the schedule mode
+	schedules map[StreamID]*Schedule
+	// When to archive the next snapshot, and when they were last pruned. One snapshot is archived at a time.
+	nextSnapshot      time.Time
+	lastSnapshotPrune time.Time
+	archivingSnapshot atomic.Bool
+	nextClockSync     time.Time
+	// Whether the device info has been checked against the configuration, in the background
+	probed    atomic.Bool
+	probing   atomic.Bool
+	nextProbe time.Time
+	// Streams of Save which the device turns out not to have. Save itself does not change once the camera runs.
+	rejected      map[StreamID]bool
+	rejectedMutex sync.Mutex
+	// The backfill runs in the background; the device files it has done are not downloaded again
+	nextBackfill time.Time
+	backfilling  atomic.Bool
+	backfilled   map[string]bool
+	talking      atomic.Bool
+	// ONVIF only: the client, and the stream URIs last resolved with it. The mutex is not held over the network.
+	onvif      *onvif.Client
+	onvifURIs  []string
+	onvifMutex sync.Mutex
+	// The DVRIP alarms are watched in the background, unless the device has none
+	watchingAlarms atomic.Bool
+	nextAlarms     time.Time
+	alarmsDone     atomic.Bool
+	// The ONVIF events are pulled in the background, unless the device has none
+	watchingONVIF   atomic.Bool
+	nextONVIFEvents time.Time
+	onvifEventsDone atomic.Bool
 }
 
 func isReachable(ctx context.Context, ip string, port int) bool {
@@ -64,18 +180,78 @@ func StreamID2String(sId StreamID) string {
 }
 
 func (c *Camera) HasAnythingToDo() bool {
-	return !c.IsDisabled && (len(c.Save) > 0 || len(c.WebCast) > 0)
+	return !c.IsDisabled && (len(c.Save) > 0 || len(c.WebCast) > 0 || c.SnapshotInterval > 0 || c.ClockSyncInterval > 0)
 }
 
-func (c *Camera) Init(baseDir string) {
+func GetDstDir(baseDir string, name CamName) string {
+	return baseDir + "/" + string(name)
+}
+
+// Init prepares the camera for running. The index of recordings is optional.
+// Alarms of DVRIP cameras and events of ONVIF cameras are published to the event bus, if given.
+func (c *Camera) Init(baseDir string, index *recindex.Index, events *event.Bus) {
 	// Even though Camera acts as a server, we don't want it to stop when all clients removed.
 	// It will be started automatically when added to CCTV.
 	c.SetPrincipallyClient(true)
-	c.dstDir = baseDir + "/" + string(c.Name)
+	c.dstDir = GetDstDir(baseDir, c.Name)
+	c.index = index
+	c.events = events
 	c.GetNode().ID = "Camera [" + string(c.Name) + "]"
 	if c.User == "" {
 		c.User = "admin"
 	}
+	c.clockZone = time.Local
+	if c.CameraTimeZone != "" {
+		if loc, err := time.LoadLocation(c.CameraTimeZone); err == nil {
+			c.clockZone = loc
+		} else {
+			log.Printf("%v: invalid CameraTimeZone, using the host's one: %v", c.GetNode().ID, err)
+		}
+	}
+	transports := []string{c.RTSPTransport}
+	for _, s := range c.Streams {
+		transports = append(transports, s.RTSPTransport)
+	}
+	for _, t := range transports {
+		if _, err := rtsp.ParseTransport(t); err != nil {
+			log.Printf("%v: %v, using the automatic one", c.GetNode().ID, err)
+		}
+	}
+	c.dropInvalidStreams()
+	c.rejected = map[StreamID]bool{}
+	c.triggers = map[StreamID]*eventTrigger{}
+	c.schedules = map[StreamID]*Schedule{}
+	for _, sId := range c.Save {
+		rc := c.getRecordConfig(sId)
+		switch rc.RecordMode {
+		case RecordContinuous:
+		case RecordEvents:
+			c.triggers[sId] = newEventTrigger(rc.PostRoll)
+		case RecordSchedule:
+			if rc.Schedule == nil {
+				log.Printf("%v: no Schedule for stream %v, recording continuously", c.GetNode().ID, sId)
+			} else if err := rc.Schedule.init(); err != nil {
+				log.Printf("%v: invalid Schedule for stream %v, recording continuously: %v", c.GetNode().ID, sId, err)
+			} else {
+				c.schedules[sId] = rc.Schedule
+			}
+		default:
+			log.Printf("%v: unknown RecordMode %q of stream %v, recording continuously", c.GetNode().ID, rc.RecordMode, sId)
+		}
+	}
+	c.backfilled = map[string]bool{}
+	if c.Backfill > 0 && !c.canBackfill() {
+		log.Printf("%v: Backfill needs the index, and the main stream recorded continuously over DVRIP", c.GetNode().ID)
+	}
+	if len(c.triggers) > 0 && events != nil {
+		events.Subscribe(func(e *event.Event) {
+			if e.Camera == string(c.Name) {
+				for _, t := range c.triggers {
+					t.handle(e)
+				}
+			}
+		})
+	}
 	c.SetTask(func(ch chan bool) {
 		for {
 			select {
@@ -85,10 +261,21 @@ func (c *Camera) Init(baseDir string) {
 				<-ch
 				return
 			default:
-				if len(c.Save) > 0 && !c.isSavingAllThatItShould() {
+				now := time.Now()
+				c.maybeProbe(now)
+				c.maybeArchiveSnapshot(now)
+				c.maybeSyncClock(now)
+				c.maybeBackfill(now)
+				c.maybeWatchAlarms(now)
+				c.maybeWatchONVIFEvents(now)
+				c.applySchedules(now)
+				c.stopRejectedStreams()
+				if len(c.Save) > 0 && !c.isSavingAllThatItShould(now) {
 					if c.isOnline() {
 						for _, s := range c.Save {
-							c.GetStream(s)
+							if c.shouldSave(s, now) {
+								c.GetStream(s).startRecording()
+							}
 						}
 					} else {
 						log.Printf("%v is offline, retrying in 5s...", c.GetNode().ID)
@@ -111,46 +298,139 @@ func (c *Camera) GetStream(sId StreamID) *Stream {
 		}
 	}
 	// Stream does not exist yet.
-	UseRTSP := false
-	for _, s := range c.Streams {
-		if s.ID == sId && s.UseRTSP {
-			UseRTSP = true
-			break
-		}
-	}
 	stream := &Stream{
-		ID:      sId,
-		UseRTSP: UseRTSP,
-		camera:  c,
+		ID:     sId,
+		camera: c,
 	}
 	stream.Init()
 	c.AddClient(stream)
 	return stream
 }
 
+// Stream-level chunk settings take precedence over the camera-level ones
+func (c *Camera) getChunkConfig(sId StreamID) ChunkConfig {
+	cc := c.ChunkConfig
+	for _, s := range c.Streams {
+		if s.ID == sId {
+			if s.ChunkDuration > 0 {
+				cc.ChunkDuration = s.ChunkDuration
+			}
+			if s.MaxChunkSize > 0 {
+				cc.MaxChunkSize = s.MaxChunkSize
+			}
+			if s.AlignChunks {
+				cc.AlignChunks = true
+			}
+			break
+		}
+	}
+	if cc.ChunkDuration <= 0 {
+		cc.ChunkDuration = defaultChunkDuration
+	}
+	return cc
+}
+
+// Stream-level record settings take precedence over the camera-level ones
+func (c *Camera) getRecordConfig(sId StreamID) RecordConfig {
+	rc := c.RecordConfig
+	for _, s := range c.Streams {
+		if s.ID == sId {
+			if s.RecordMode != "" {
+				rc.RecordMode = s.RecordMode
+			}
+			if s.PreRoll > 0 {
+				rc.PreRoll = s.PreRoll
+			}
+			if s.PostRoll > 0 {
+				rc.PostRoll = s.PostRoll
+			}
+			if s.MotionHeuristic {
+				rc.MotionHeuristic = true
+			}
+			if s.Schedule != nil {
+				rc.Schedule = s.Schedule
+			}
+			break
+		}
+	}
+	if rc.RecordMode == "" {
+		rc.RecordMode = RecordContinuous
+	}
+	if rc.PreRoll <= 0 {
+		rc.PreRoll = defaultEventRoll
+	}
+	if rc.PostRoll <= 0 {
+		rc.PostRoll = defaultEventRoll
+	}
+	return rc
+}
+
 func (c *Camera) getPingArgs() (string, int) {
-	var port int
-	if c.Type == "BITVISION" || c.UseRTSP {
-		port = 554
-	} else {
-		port = 34567
+	// The port of the URIs resolved over ONVIF, if any
+	port := c.onvifRTSPPort()
+	if port == 0 {
+		switch c.cameraSource() {
+		case SourceRTSP:
+			port = c.getRTSPPort()
+		case SourceDVRIP:
+			port = 34567
+		}
 	}
 	return c.Address, port
 }
 
 func (c *Camera) isOnline() bool {
 	a, b := c.getPingArgs()
+	if b == 0 {
+		// Another source: nothing known to ping, its monitor tells
+		return true
+	}
 	return isReachable(c.Node.Ctx, a, b)
 }
 
-func (c *Camera) isSavingAllThatItShould() bool {
-	shouldBeSaving := make([]StreamID, len(c.Save))
-	copy(shouldBeSaving, c.Save)
+// shouldSave tells whether the stream is to be recorded at the time, as per Save and its schedule
+func (c *Camera) shouldSave(sId StreamID, t time.Time) bool {
+	if !slices.Contains(c.Save, sId) || c.isRejected(sId) {
+		return false
+	}
+	schedule, ok := c.schedules[sId]
+	return !ok || schedule.Contains(t)
+}
+
+// applySchedules starts and stops recording of the running streams at the boundaries of their schedules.
+// A stream not recorded stops unless it is being webcast.
+func (c *Camera) applySchedules(t time.Time) {
+	if len(c.schedules) == 0 {
+		return
+	}
+	for _, _s := range c.Clients {
+		stream := _s.(*Stream)
+		if _, ok := c.schedules[stream.ID]; !ok || stream.IsStopping() {
+			continue
+		}
+		if c.shouldSave(stream.ID, t) {
+			if !stream.isRecording() && stream.startRecording() {
+				log.Printf("%v: recording by the schedule", stream.GetNode().ID)
+			}
+		} else if stream.isRecording() {
+			log.Printf("%v: not recording by the schedule", stream.GetNode().ID)
+			stream.stopRecording()
+		}
+	}
+}
+
+func (c *Camera) isSavingAllThatItShould(t time.Time) bool {
+	var shouldBeSaving []StreamID
+	for _, sId := range c.Save {
+		if c.shouldSave(sId, t) {
+			shouldBeSaving = append(shouldBeSaving, sId)
+		}
+	}
 	for _, _s := range c.Clients {
 		stream := _s.(*Stream)
 		i := slices.Index(shouldBeSaving, stream.ID)
 		if i > -1 {
-			shouldBeSaving = slices.Delete(shouldBeSaving, i, 1)
+			shouldBeSaving = slices.Delete(shouldBeSaving, i, i+1)
 		}
 	}
 	return len(shouldBeSaving) == 0
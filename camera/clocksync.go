@@ -0,0 +1,49 @@
+package camera
+
+import (
+	"github.com/greendrake/cctv/dvr"
+	"log"
+	"time"
+)
+
+// The camera clock is read and set with second precision, so a smaller skew is left alone
+const minClockSkew = 2 * time.Second
+
+// maybeSyncClock syncs the camera clock if it is time to (ClockSyncInterval), starting right away
+func (c *Camera) maybeSyncClock(now time.Time) {
+	if c.ClockSyncInterval <= 0 || !c.isDVRIP() || now.Before(c.nextClockSync) {
+		return
+	}
+	c.nextClockSync = now.Add(c.ClockSyncInterval)
+	go c.syncClock()
+}
+
+// syncClock sets the camera clock to the host one (in CameraTimeZone), logging the skew it had
+func (c *Camera) syncClock() {
+	err := c.withDVRIP(func(client *dvrip.Client) error {
+		camTime, err := client.GetTime(c.clockZone)
+		if err != nil {
+			return err
+		}
+		skew := camTime.Sub(time.Now()).Round(time.Second)
+		if skew.Abs() < minClockSkew {
+			return nil
+		}
+		if err = client.SetTime(time.Now().In(c.clockZone)); err != nil {
+			return err
+		}
+		// Read back to check it has taken
+		if camTime, err = client.GetTime(c.clockZone); err != nil {
+			return err
+		}
+		if after := camTime.Sub(time.Now()).Round(time.Second); after.Abs() >= minClockSkew {
+			log.Printf("%v: clock was off by %v, and is still off by %v after setting it", c.GetNode().ID, skew, after)
+		} else {
+			log.Printf("%v: clock was off by %v, corrected", c.GetNode().ID, skew)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("%v: cannot sync the clock: %v", c.GetNode().ID, err)
+	}
+}
@@ -0,0 +1,37 @@
+package camera
+
+import (
+	"context"
+	"github.com/greendrake/cctv/dvr"
+)
+
+func (c *Camera) isDVRIP() bool {
+	return c.cameraSource() == SourceDVRIP
+}
+
+// newDVRIPMonitor is the dvrip source: channels of an NVR share its session
+func newDVRIPMonitor(ctx context.Context, c *Camera, sId StreamID) (Monitor, error) {
+	session, err := dvrip.AcquireSession(ctx, c.Address, c.User, c.Password)
+	if err != nil {
+		return nil, err
+	}
+	m := dvrip.NewMonitor(ctx, session, c.Channel, StreamID2String(sId))
+	m.Clock = &dvrip.Clock{
+		Name:     c.GetNode().ID,
+		Location: c.clockZone,
+		MaxDrift: c.MaxClockDrift,
+		Stamp:    c.UseCameraClock,
+	}
+	return m, nil
+}
+
+// withDVRIP runs f with the control connection of the DVRIP session of the device,
+// which is shared with the monitors of the device, if any
+func (c *Camera) withDVRIP(f func(client *dvrip.Client) error) error {
+	session, err := dvrip.AcquireSession(context.Background(), c.Address, c.User, c.Password)
+	if err != nil {
+		return err
+	}
+	defer session.Release()
+	return session.Do(f)
+}
@@ -0,0 +1,60 @@
+package camera
+
+import (
+	"errors"
+	"github.com/greendrake/cctv/dvr"
+	"github.com/greendrake/cctv/event"
+	"log"
+	"time"
+)
+
+// How often to retry watching the alarms of a DVRIP device, at most
+const alarmsRetry = time.Minute
+
+// maybeWatchAlarms starts publishing the alarms of the DVRIP camera, unless it is on it already or the device has none.
+// They come over a connection of their own, so that they do not depend on which streams run (e.g. by a schedule).
+func (c *Camera) maybeWatchAlarms(now time.Time) {
+	if !c.isDVRIP() || c.events == nil || c.alarmsDone.Load() || now.Before(c.nextAlarms) || c.watchingAlarms.Load() {
+		return
+	}
+	c.nextAlarms = now.Add(alarmsRetry)
+	c.watchingAlarms.Store(true)
+	go func() {
+		defer c.watchingAlarms.Store(false)
+		session, err := dvrip.AcquireSession(c.Node.Ctx, c.Address, c.User, c.Password)
+		if err == nil {
+			err = session.WatchAlarms(c.Node.Ctx, c.clockZone, func(a *dvrip.Alarm) {
+				// The device pushes the alarms of all its channels
+				if a.Channel == c.Channel {
+					c.publishAlarm(a)
+				}
+			})
+			session.Release()
+		}
+		if err == nil || c.Node.Ctx.Err() != nil {
+			return
+		}
+		var se *dvrip.StatusError
+		if errors.As(err, &se) {
+			// The device refuses to report alarms, no use asking again
+			c.alarmsDone.Store(true)
+		}
+		log.Printf("%v: DVRIP alarms: %v", c.GetNode().ID, err)
+	}()
+}
+
+// publishAlarm turns the DVRIP alarm into an event of the camera
+func (c *Camera) publishAlarm(a *dvrip.Alarm) {
+	t := a.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+	c.events.Publish(&event.Event{
+		Camera:  string(c.Name),
+		Channel: a.Channel,
+		Type:    a.Type(),
+		Start:   a.Start,
+		Time:    t,
+		Name:    a.Event,
+	})
+}
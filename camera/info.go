@@ -0,0 +1,136 @@
+package camera
+
+import (
+	"errors"
+	"fmt"
+	"github.com/greendrake/cctv/dvr"
+	"github.com/greendrake/cctv/util"
+	"log"
+	"slices"
+	"strings"
+	"time"
+)
+
+// How often to retry probing a device which could not be reached
+const probeRetryInterval = time.Minute
+
+// Stream types of DVRIP devices by stream ID
+var dvripStreamTypes = map[StreamID]string{
+	StreamMain:  "Main",
+	StreamExtra: "Extra",
+}
+
+// DeviceInfo queries the device over DVRIP
+func (c *Camera) DeviceInfo() (*dvrip.DeviceInfo, error) {
+	if !c.isDVRIP() {
+		return nil, fmt.Errorf("%w: device info is available over DVRIP only", util.ErrNotSupported)
+	}
+	var info *dvrip.DeviceInfo
+	err := c.withDVRIP(func(client *dvrip.Client) (err error) {
+		info, err = client.DeviceInfo()
+		return
+	})
+	return info, err
+}
+
+// streamUsesDVRIP tells whether the stream is pulled over DVRIP rather than another source
+func (c *Camera) streamUsesDVRIP(sId StreamID) bool {
+	return c.streamSource(sId) == SourceDVRIP
+}
+
+// dropInvalidStreams drops the stream IDs of Save and WebCast which no DVRIP device has, and the ones of unknown sources
+func (c *Camera) dropInvalidStreams() {
+	invalid := func(sId StreamID) bool {
+		if source := c.streamSource(sId); !slices.Contains(Sources(), source) {
+			log.Printf("%v: unknown Source %q of stream %v, the known ones are %v", c.GetNode().ID, source, sId, strings.Join(Sources(), ", "))
+			return true
+		}
+		if _, ok := dvripStreamTypes[sId]; !ok && c.streamUsesDVRIP(sId) {
+			log.Printf("%v: there is no stream %v, only 0 (main) and 1 (extra)", c.GetNode().ID, sId)
+			return true
+		}
+		return false
+	}
+	c.Save = slices.DeleteFunc(c.Save, invalid)
+	c.WebCast = slices.DeleteFunc(c.WebCast, invalid)
+}
+
+// maybeProbe starts learning what the device is in the background, unless it has already or is on it.
+// It goes on retrying until the device can be reached.
+func (c *Camera) maybeProbe(now time.Time) {
+	if c.probed.Load() || !(c.isDVRIP() || c.isONVIF()) || now.Before(c.nextProbe) || c.probing.Load() {
+		return
+	}
+	c.nextProbe = now.Add(probeRetryInterval)
+	c.probing.Store(true)
+	go func() {
+		defer c.probing.Store(false)
+		if c.isONVIF() {
+			c.probed.Store(c.probeONVIF())
+		} else {
+			c.probed.Store(c.probeDVRIP())
+		}
+	}()
+}
+
+// probeDVRIP logs what the device is, and stops recording the streams it does not have. Returns whether it is done.
+func (c *Camera) probeDVRIP() bool {
+	info, err := c.DeviceInfo()
+	if err != nil {
+		log.Printf("%v: cannot get the device info: %v", c.GetNode().ID, err)
+		// Unless the device does not support the queries
+		var se *dvrip.StatusError
+		return errors.As(err, &se)
+	}
+	log.Printf("%v: %v (firmware %v, serial number %v), %v channel(s), streams %v, codecs %v", c.GetNode().ID,
+		info.System.Model, info.System.Firmware, info.System.SerialNo, info.System.Channels(),
+		info.Capabilities.Streams, info.Capabilities.Codecs)
+	if n := info.System.Channels(); n > 0 && c.Channel >= n {
+		log.Printf("%v: the device has no channel %v (0-based), only %v", c.GetNode().ID, c.Channel, n)
+	}
+	for _, sId := range c.Save {
+		if !c.streamUsesDVRIP(sId) {
+			continue
+		}
+		supported, known := info.Capabilities.SupportsStream(dvripStreamTypes[sId])
+		if !known {
+			log.Printf("%v: the device does not tell whether it has stream %v, recording it anyway", c.GetNode().ID, sId)
+		} else if !supported {
+			log.Printf("%v: the device has no stream %v, not recording it", c.GetNode().ID, sId)
+			c.rejectStream(sId)
+		}
+	}
+	for _, sId := range c.WebCast {
+		if !c.streamUsesDVRIP(sId) {
+			continue
+		}
+		if supported, known := info.Capabilities.SupportsStream(dvripStreamTypes[sId]); known && !supported {
+			log.Printf("%v: the device has no stream %v to webcast", c.GetNode().ID, sId)
+		}
+	}
+	return true
+}
+
+// rejectStream marks the stream of Save as missing on the device, so that it is not recorded.
+// The supervisor stops recording it, if it has started already.
+func (c *Camera) rejectStream(sId StreamID) {
+	c.rejectedMutex.Lock()
+	defer c.rejectedMutex.Unlock()
+	c.rejected[sId] = true
+}
+
+func (c *Camera) isRejected(sId StreamID) bool {
+	c.rejectedMutex.Lock()
+	defer c.rejectedMutex.Unlock()
+	return c.rejected[sId]
+}
+
+// stopRejectedStreams stops recording the streams found missing on the device
+func (c *Camera) stopRejectedStreams() {
+	for _, _s := range c.Clients {
+		stream := _s.(*Stream)
+		if c.isRejected(stream.ID) && stream.isRecording() {
+			stream.stopRecording()
+		}
+	}
+}
@@ -4,17 +4,24 @@ import (
 	// "log"
 	"errors"
 	"fmt"
-	dvrframe "github.com/greendrake/cctv/dvr/frame"
+	"github.com/greendrake/cctv/event"
 	"github.com/greendrake/cctv/frame"
 	"github.com/greendrake/cctv/muxer/ebml/matroska"
+	"github.com/greendrake/cctv/recindex"
 	"github.com/greendrake/server_client_hierarchy"
+	"log"
 	"os"
 	"path/filepath"
+	"slices"
 	"sync"
 	"time"
 )
 
-const chunkDuration time.Duration = 10 * time.Minute
+const defaultChunkDuration time.Duration = 10 * time.Minute
+
+// With the camera clock in use, a bigger discrepancy between it and the position in the file
+// (e.g. because the clock has been set) starts a new file
+const maxClockJump time.Duration = 5 * time.Second
 
 // This struct is client to Stream
 
@@ -26,17 +33,46 @@ type MKVWriter struct {
 	audioTimePosition     time.Duration
 	mkv                   *matroska.Matroska
 	HasAudio              bool
+	// Format of the audio frames. Audio is not written without it.
+	audio                 *frame.AudioFormat
 	FileSuff              string
 	IsHEVC                bool
 	lastFrameAudio        bool
 	lastAudioTimePosition time.Duration
 	closeMutex            sync.Mutex
+	ChunkConfig
+	// Wall-clock time of the next aligned split (AlignChunks only)
+	nextSplitAt time.Time
+	// Index of recordings. Optional.
+	index   *recindex.Index
+	camName string
+	// Index entry of the chunk currently being written
+	rec       *recindex.Recording
+	keyframes int
+	// Written into every file
+	tags []matroska.Tag
+	// Start time of the current file by the camera clock (if frames carry it)
+	chunkStart time.Time
+	// Events mode only: when to record, and the frames kept meanwhile for the pre-roll
+	trigger  *eventTrigger
+	preRoll  time.Duration
+	buffered []bufferedFrame
+	// The event the current clip was started by (events mode only)
+	cause *event.Event
+	// Start time of the next file if it starts with frames received earlier
+	nextFileTime time.Time
+}
+
+// bufferedFrame is a frame kept for the pre-roll, with the time it was received
+type bufferedFrame struct {
+	f  *frame.Frame
+	at time.Time
 }
 
 func (w *MKVWriter) Init() {
 	w.SetPrincipallyClient(true)
 	w.SetIChunkHandler(func(chunk any) {
-		w.writeFrame(chunk.(*frame.Frame))
+		w.handleFrame(chunk.(*frame.Frame))
 	})
 	w.On("stop", func(args ...any) {
 		w.close()
@@ -47,9 +83,96 @@ func (w *MKVWriter) close() {
 	w.closeMutex.Lock()
 	defer w.closeMutex.Unlock()
 	if w.mkv != nil {
-		w.mkv.Close()
+		w.finalize(w.mkv, w.rec, w.videoTimePosition, w.keyframes)
 		w.mkv = nil
+		w.rec = nil
+	}
+}
+
+// finalize closes the chunk and completes its index entry
+func (w *MKVWriter) finalize(mkv *matroska.Matroska, rec *recindex.Recording, duration time.Duration, keyframes int) {
+	mkv.Close()
+	if w.index == nil || rec == nil {
+		return
+	}
+	rec.Duration = duration
+	rec.End = rec.Start.Add(duration)
+	rec.Keyframes = keyframes
+	if info, err := os.Stat(w.dstDir + "/" + recindex.ChunkPath(rec.Start, rec.Stream)); err == nil {
+		rec.Size = info.Size()
+	}
+	if err := w.index.Put(rec); err != nil {
+		log.Printf("Cannot update the index entry of %v: %v", rec.Path, err)
+	}
+}
+
+// handleFrame writes the frame or, in the events mode, keeps it for the pre-roll unless an event goes on
+func (w *MKVWriter) handleFrame(f *frame.Frame) error {
+	if w.trigger == nil {
+		return w.writeFrame(f)
+	}
+	now := time.Now()
+	active, cause := w.trigger.active(now)
+	if !active {
+		if w.mkv != nil {
+			log.Printf("Event clip of %v:%v ends", w.camName, w.FileSuff)
+			w.close()
+		}
+		w.bufferFrame(f, now)
+		return nil
+	}
+	if w.mkv == nil {
+		// A clip starts with the pre-roll, which starts with a key frame
+		w.bufferFrame(f, now)
+		if len(w.buffered) == 0 {
+			return nil
+		}
+		if cause != nil {
+			log.Printf("Event clip of %v:%v starts on %v", w.camName, w.FileSuff, cause)
+		}
+		w.cause = cause
+		w.resetPositions()
+		w.nextFileTime = w.buffered[0].at
+		buffered := w.buffered
+		w.buffered = nil
+		for _, b := range buffered {
+			if err := w.writeFrame(b.f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return w.writeFrame(f)
+}
+
+// bufferFrame keeps the frame for the pre-roll, dropping the frames older than it (up to the key frame before)
+func (w *MKVWriter) bufferFrame(f *frame.Frame, now time.Time) {
+	if len(w.buffered) == 0 && (!f.IsVideo || !f.IsVideoKeyFrame) {
+		return
+	}
+	w.buffered = append(w.buffered, bufferedFrame{f, now})
+	horizon := now.Add(-w.preRoll)
+	cut := 0
+	for i, b := range w.buffered {
+		if b.at.After(horizon) {
+			break
+		}
+		if b.f.IsVideo && b.f.IsVideoKeyFrame {
+			cut = i
+		}
 	}
+	if cut > 0 {
+		clear(w.buffered[:cut])
+		w.buffered = w.buffered[cut:]
+	}
+}
+
+func (w *MKVWriter) resetPositions() {
+	w.videoTimePosition = 0
+	w.audioTimePosition = 0
+	w.lastVideoTimePosition = 0
+	w.lastAudioTimePosition = 0
+	w.lastFrameAudio = false
 }
 
 func (w *MKVWriter) writeFrame(f *frame.Frame) error {
@@ -58,15 +181,15 @@ func (w *MKVWriter) writeFrame(f *frame.Frame) error {
 		w.IsHEVC = true
 	}
 	if w.mkv == nil {
-		if w.mkv, err = w.createMKVFile(); err != nil {
+		if w.mkv, err = w.createMKVFile(f.Time); err != nil {
 			return err
 		}
 	}
 	if f.IsVideo {
 		if f.IsVideoKeyFrame {
-			if (w.videoTimePosition + f.Duration) > chunkDuration {
-				go w.mkv.Close()
-				if w.mkv, err = w.createMKVFile(); err != nil {
+			if w.shouldSplit(f) {
+				go w.finalize(w.mkv, w.rec, w.videoTimePosition, w.keyframes)
+				if w.mkv, err = w.createMKVFile(f.Time); err != nil {
 					return err
 				}
 				w.videoTimePosition = 0
@@ -76,16 +199,26 @@ func (w *MKVWriter) writeFrame(f *frame.Frame) error {
 				w.lastFrameAudio = false
 			}
 		}
+		if !f.Time.IsZero() && !w.chunkStart.IsZero() {
+			// Position by the camera clock, keeping it monotonic
+			w.videoTimePosition = f.Time.Sub(w.chunkStart)
+			if w.videoTimePosition <= w.lastVideoTimePosition && w.keyframes > 0 {
+				w.videoTimePosition = w.lastVideoTimePosition + time.Millisecond
+			}
+		}
 		_, err = w.mkv.WriteVideo(w.videoTimePosition, *f.Data)
 		if err != nil {
 			return errors.New(fmt.Sprintf("Error writing video frame at position %s: [%s]. Last video position: %s; Last audio position: %s", w.videoTimePosition, err, w.lastVideoTimePosition, w.lastAudioTimePosition))
 		}
+		if f.IsVideoKeyFrame {
+			w.keyframes++
+		}
 		w.lastVideoTimePosition = w.videoTimePosition
 		w.videoTimePosition += f.Duration
 		if w.lastFrameAudio {
 			w.lastFrameAudio = false
 		}
-	} else if f.IsAudio && w.HasAudio {
+	} else if f.IsAudio && w.HasAudio && w.audio != nil {
 		if !w.lastFrameAudio {
 			w.audioTimePosition = w.lastVideoTimePosition
 		}
@@ -102,9 +235,69 @@ func (w *MKVWriter) writeFrame(f *frame.Frame) error {
 	return nil
 }
 
-func (w *MKVWriter) createMKVFile() (*matroska.Matroska, error) {
+func (w *MKVWriter) shouldSplit(f *frame.Frame) bool {
+	if w.MaxChunkSize > 0 && int64(w.mkv.FileSize()) >= int64(w.MaxChunkSize) {
+		return true
+	}
+	now := time.Now()
+	if !f.Time.IsZero() && !w.chunkStart.IsZero() {
+		now = f.Time
+		if jump := f.Time.Sub(w.chunkStart) - w.videoTimePosition; jump > maxClockJump || jump < -maxClockJump {
+			log.Printf("Camera %v clock jumped by %v, starting a new file", w.camName, jump)
+			return true
+		}
+	}
+	if w.AlignChunks {
+		return !now.Before(w.nextSplitAt)
+	}
+	return (w.videoTimePosition + f.Duration) > w.ChunkDuration
+}
+
+// nextAlignedSplit returns the first multiple of d (counting from the local midnight) after t.
+// The count starts over at the next midnight, as d may not divide the day (nor a day of 23 or 25 hours).
+func nextAlignedSplit(t time.Time, d time.Duration) time.Time {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	next := midnight.Add((t.Sub(midnight)/d + 1) * d)
+	if nextMidnight := time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location()); next.After(nextMidnight) {
+		return nextMidnight
+	}
+	return next
+}
+
+// newAudioTrack makes the Matroska track matching the audio format
+func newAudioTrack(a *frame.AudioFormat) matroska.Track {
+	switch a.Codec {
+	case frame.AudioCodecPCMU:
+		return matroska.NewTrackPCMU(a.SampleRate, a.Channels)
+	case frame.AudioCodecAAC:
+		return matroska.NewTrackAAC(a.SampleRate, a.Channels, matroska.WithAACConfig(a.Config))
+	}
+	return matroska.NewTrackPCMA(a.SampleRate, a.Channels)
+}
+
+// createMKVFile starts a new file at the given camera time of its first frame, or the host time if zero
+func (w *MKVWriter) createMKVFile(camTime time.Time) (*matroska.Matroska, error) {
 	t := time.Now()
-	path := w.dstDir + "/" + t.Format("2006/01/02/15-04-05.") + w.FileSuff + ".mkv"
+	if !w.nextFileTime.IsZero() {
+		t = w.nextFileTime
+		w.nextFileTime = time.Time{}
+	}
+	if !camTime.IsZero() {
+		t = camTime.Local()
+	}
+	w.chunkStart = camTime
+	if w.ChunkDuration <= 0 {
+		w.ChunkDuration = defaultChunkDuration
+	}
+	if w.AlignChunks {
+		w.nextSplitAt = nextAlignedSplit(t, w.ChunkDuration)
+	}
+	path := w.dstDir + "/" + recindex.ChunkPath(t, w.FileSuff)
+	// Never overwrite an existing chunk, which may happen if the camera clock has been set back
+	for _, err := os.Stat(path); err == nil; _, err = os.Stat(path) {
+		t = t.Add(time.Second)
+		path = w.dstDir + "/" + recindex.ChunkPath(t, w.FileSuff)
+	}
 	directoryPath := filepath.Dir(path)
 	err := os.MkdirAll(directoryPath, os.ModePerm)
 	if err != nil {
@@ -121,8 +314,35 @@ func (w *MKVWriter) createMKVFile() (*matroska.Matroska, error) {
 		vt = matroska.NewTrackH264()
 	}
 	tracks := []matroska.Track{vt}
-	if w.HasAudio {
-		tracks = append(tracks, matroska.NewTrackPCMA(int(dvrframe.ExpectedAudioSampleRate), 1))
+	if w.HasAudio && w.audio != nil {
+		tracks = append(tracks, newAudioTrack(w.audio))
+	}
+	// The file is created on the first frame of the chunk, so its start time is that of the frame
+	tags := w.tags
+	if w.cause != nil {
+		tags = append(slices.Clip(tags), matroska.Tag{Name: "EVENT", Value: fmt.Sprintf("%v (%v)", w.cause.Type, w.cause.Name)})
+	}
+	mkv, err := matroska.OpenWithOptions(file, tracks, matroska.WithDateUTC(t), matroska.WithTags(tags...))
+	if err != nil {
+		return nil, err
+	}
+	w.keyframes = 0
+	w.rec = nil
+	if w.index != nil {
+		codec := "H264"
+		if w.IsHEVC {
+			codec = "H265"
+		}
+		w.rec = &recindex.Recording{
+			Camera: w.camName,
+			Stream: w.FileSuff,
+			Path:   w.camName + "/" + recindex.ChunkPath(t, w.FileSuff),
+			Start:  t,
+			Codec:  codec,
+		}
+		if err := w.index.Put(w.rec); err != nil {
+			log.Printf("Cannot add %v to the index: %v", path, err)
+		}
 	}
-	return matroska.Open(file, tracks...)
+	return mkv, nil
 }
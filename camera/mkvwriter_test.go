@@ -0,0 +1,50 @@
+package camera
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextAlignedSplit(t *testing.T) {
+	nz, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(s string) time.Time {
+		t0, err := time.ParseInLocation(time.DateTime, s, nz)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return t0
+	}
+	tests := []struct {
+		t    string
+		d    time.Duration
+		next string
+	}{
+		{"2024-05-01 12:03:00", 10 * time.Minute, "2024-05-01 12:10:00"},
+		{"2024-05-01 12:10:00", 10 * time.Minute, "2024-05-01 12:20:00"},
+		// Across the day boundary
+		{"2024-05-01 23:55:00", 10 * time.Minute, "2024-05-02 00:00:00"},
+		{"2024-05-01 23:58:00", 7 * time.Minute, "2024-05-02 00:00:00"},
+		{"2024-05-01 23:30:00", time.Hour, "2024-05-02 00:00:00"},
+		{"2024-05-01 13:00:00", 24 * time.Hour, "2024-05-02 00:00:00"},
+		// NZDT ends, 03:00 becomes 02:00 again (a 25-hour day)
+		{"2024-04-07 03:05:00", 10 * time.Minute, "2024-04-07 03:10:00"},
+		{"2024-04-07 03:30:00", time.Hour, "2024-04-07 04:00:00"},
+		{"2024-04-07 23:30:00", time.Hour, "2024-04-08 00:00:00"},
+		// 24 hours after the midnight, and then the midnight
+		{"2024-04-07 13:00:00", 24 * time.Hour, "2024-04-07 23:00:00"},
+		{"2024-04-07 23:00:00", 24 * time.Hour, "2024-04-08 00:00:00"},
+		// NZDT starts, 02:00 becomes 03:00 (a 23-hour day)
+		{"2024-09-29 01:55:00", 10 * time.Minute, "2024-09-29 03:00:00"},
+		{"2024-09-29 03:05:00", 10 * time.Minute, "2024-09-29 03:10:00"},
+		{"2024-09-29 23:30:00", time.Hour, "2024-09-30 00:00:00"},
+		{"2024-09-29 13:00:00", 24 * time.Hour, "2024-09-30 00:00:00"},
+	}
+	for _, test := range tests {
+		if next := nextAlignedSplit(at(test.t), test.d); !next.Equal(at(test.next)) {
+			t.Errorf("nextAlignedSplit(%v, %v): expected %v, got %v", test.t, test.d, test.next, next.Format(time.DateTime))
+		}
+	}
+}
@@ -7,4 +7,6 @@ import (
 type Monitor interface {
 	GetFrame() (*frame.Frame, error)
 	ShutDown()
+	// AudioFormat of the audio frames, nil if the stream has no (supported) audio
+	AudioFormat() *frame.AudioFormat
 }
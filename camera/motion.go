@@ -0,0 +1,62 @@
+package camera
+
+import (
+	"github.com/greendrake/cctv/frame"
+	"time"
+)
+
+const (
+	// A P frame this many times bigger than the average means motion
+	motionFactor = 3.0
+	// Weight of a frame in the moving average of P frame sizes
+	motionAverageWeight = 0.02
+	// Frames to learn the average from before detecting
+	motionWarmUp = 100
+	// Motion stops when not seen for this long
+	motionHold = 5 * time.Second
+)
+
+// motionDetector guesses motion by the size of P frames: they are small while the scene is still,
+// and grow when things move as the changes get encoded. It is crude, and works best with fixed cameras.
+type motionDetector struct {
+	// Called when motion starts and stops
+	publish    func(start bool)
+	average    float64
+	frames     int
+	moving     bool
+	lastMotion time.Time
+}
+
+func (d *motionDetector) feed(f *frame.Frame) {
+	if !f.IsVideo || f.IsVideoKeyFrame {
+		return
+	}
+	now := time.Now()
+	size := float64(len(*f.Data))
+	d.frames++
+	if d.frames > motionWarmUp && size > motionFactor*d.average {
+		d.lastMotion = now
+		if !d.moving {
+			d.moving = true
+			d.publish(true)
+		}
+		// Motion does not count into the average
+		return
+	}
+	if d.frames == 1 {
+		d.average = size
+	} else {
+		d.average += motionAverageWeight * (size - d.average)
+	}
+	if d.moving && now.Sub(d.lastMotion) > motionHold {
+		d.stop()
+	}
+}
+
+// stop ends the motion, if any
+func (d *motionDetector) stop() {
+	if d.moving {
+		d.moving = false
+		d.publish(false)
+	}
+}
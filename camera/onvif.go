@@ -0,0 +1,118 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"github.com/greendrake/cctv/onvif"
+	"github.com/greendrake/cctv/util"
+	"log"
+	"net/url"
+	"slices"
+	"strconv"
+	"time"
+)
+
+const onvifTimeout = 15 * time.Second
+
+func (c *Camera) isONVIF() bool {
+	return c.Type == "ONVIF"
+}
+
+// onvifClient returns the ONVIF client of the camera, making it on first use
+func (c *Camera) onvifClient() *onvif.Client {
+	c.onvifMutex.Lock()
+	defer c.onvifMutex.Unlock()
+	if c.onvif == nil {
+		serviceURL := c.ONVIFURL
+		if serviceURL == "" {
+			serviceURL = "http://" + c.Address + onvif.DefaultPath
+		}
+		c.onvif = onvif.NewClient(serviceURL, c.User, c.Password)
+	}
+	return c.onvif
+}
+
+// resolveONVIF asks the camera for the RTSP URIs of its media profiles, which are its streams in order
+// (0 is the main one, 1 the sub one). If it does not answer, the URIs it gave last time are used.
+func (c *Camera) resolveONVIF(ctx context.Context) ([]string, error) {
+	client := c.onvifClient()
+	ctx, cancel := context.WithTimeout(ctx, onvifTimeout)
+	defer cancel()
+	// Not under the mutex, which the supervisor takes to ping the camera
+	uris, err := client.StreamURIs(ctx)
+	c.onvifMutex.Lock()
+	defer c.onvifMutex.Unlock()
+	if err != nil {
+		if _, ok := err.(*util.WrongCredentialsError); ok || c.onvifURIs == nil {
+			return nil, err
+		}
+		log.Printf("%v: cannot resolve the ONVIF streams, using the last known ones: %v", c.GetNode().ID, err)
+		return c.onvifURIs, nil
+	}
+	if !slices.Equal(uris, c.onvifURIs) {
+		for i, uri := range uris {
+			if u, err := url.Parse(uri); err == nil {
+				uri = u.Redacted()
+			}
+			log.Printf("%v: ONVIF stream %v is %v", c.GetNode().ID, i, uri)
+		}
+	}
+	c.onvifURIs = uris
+	return uris, nil
+}
+
+// onvifStreamURI resolves the RTSP URI of the stream over ONVIF
+func (c *Camera) onvifStreamURI(ctx context.Context, sId StreamID) (string, error) {
+	uris, err := c.resolveONVIF(ctx)
+	if err != nil {
+		return "", err
+	}
+	if int(sId) >= len(uris) {
+		return "", fmt.Errorf("the camera has no ONVIF profile for stream %v, only %v profile(s)", sId, len(uris))
+	}
+	return uris[sId], nil
+}
+
+// probeONVIF resolves the streams of the camera at startup, and stops recording the ones it does not have.
+// Returns whether it is done.
+func (c *Camera) probeONVIF() bool {
+	uris, err := c.resolveONVIF(context.Background())
+	if err != nil {
+		log.Printf("%v: cannot resolve the ONVIF streams: %v", c.GetNode().ID, err)
+		_, wrongCredentials := err.(*util.WrongCredentialsError)
+		return wrongCredentials
+	}
+	hasProfile := func(sId StreamID) bool {
+		return int(sId) < len(uris) || c.getRTSPURLTemplate(sId) != ""
+	}
+	for _, sId := range c.Save {
+		if !hasProfile(sId) {
+			log.Printf("%v: the camera has no ONVIF profile for stream %v, not recording it", c.GetNode().ID, sId)
+			c.rejectStream(sId)
+		}
+	}
+	for _, sId := range c.WebCast {
+		if !hasProfile(sId) {
+			log.Printf("%v: the camera has no ONVIF profile for stream %v to webcast", c.GetNode().ID, sId)
+		}
+	}
+	return true
+}
+
+// onvifRTSPPort returns the port of the RTSP URIs last resolved, or 0 if unknown
+func (c *Camera) onvifRTSPPort() int {
+	c.onvifMutex.Lock()
+	defer c.onvifMutex.Unlock()
+	if len(c.onvifURIs) == 0 {
+		return 0
+	}
+	u, err := url.Parse(c.onvifURIs[0])
+	if err != nil {
+		return 0
+	}
+	if u.Port() == "" {
+		return defaultRTSPPort
+	}
+	port, _ := strconv.Atoi(u.Port())
+	return port
+}
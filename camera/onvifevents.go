@@ -0,0 +1,110 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/greendrake/cctv/event"
+	"github.com/greendrake/cctv/onvif"
+	"github.com/greendrake/cctv/util"
+	"log"
+	"time"
+)
+
+const (
+	// The device ends the subscription this long after the last renewal, e.g. if the host goes away
+	onvifSubscriptionTerm = time.Minute
+	onvifPullTimeout      = 10 * time.Second
+	onvifPullLimit        = 32
+	onvifEventsRetry      = time.Minute
+)
+
+// maybeWatchONVIFEvents starts publishing the events of the ONVIF camera, unless it is on it already
+func (c *Camera) maybeWatchONVIFEvents(now time.Time) {
+	if !c.isONVIF() || c.events == nil || c.onvifEventsDone.Load() || now.Before(c.nextONVIFEvents) || c.watchingONVIF.Load() {
+		return
+	}
+	c.nextONVIFEvents = now.Add(onvifEventsRetry)
+	c.watchingONVIF.Store(true)
+	go func() {
+		defer c.watchingONVIF.Store(false)
+		subscribed, err := c.watchONVIFEvents(c.Node.Ctx)
+		if err == nil || c.Node.Ctx.Err() != nil {
+			return
+		}
+		if !subscribed {
+			var fault *onvif.Fault
+			_, wrongCredentials := err.(*util.WrongCredentialsError)
+			if errors.As(err, &fault) || errors.Is(err, onvif.ErrNoService) || wrongCredentials {
+				// The device has no events to give, no use asking again
+				c.onvifEventsDone.Store(true)
+			}
+		}
+		log.Printf("%v: ONVIF events: %v", c.GetNode().ID, err)
+		// Not to subscribe again right away if it has been going on for a while
+		util.SleepCtx(c.Node.Ctx, onvifEventsRetry)
+	}()
+}
+
+// watchONVIFEvents subscribes to the events of the camera and publishes them until the context is done.
+// Errors after the subscription (e.g. the device has dropped it) are worth subscribing again for.
+func (c *Camera) watchONVIFEvents(ctx context.Context) (subscribed bool, err error) {
+	subCtx, cancel := context.WithTimeout(ctx, onvifTimeout)
+	sub, err := c.onvifClient().Subscribe(subCtx, onvifSubscriptionTerm)
+	cancel()
+	if err != nil {
+		return false, err
+	}
+	log.Printf("%v: subscribed to the ONVIF events", c.GetNode().ID)
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), onvifTimeout)
+		defer cancel()
+		sub.Unsubscribe(ctx)
+	}()
+	renewed := time.Now()
+	for {
+		notifications, err := sub.Pull(ctx, onvifPullTimeout, onvifPullLimit)
+		if err != nil {
+			if ctx.Err() != nil {
+				return true, nil
+			}
+			return true, fmt.Errorf("cannot pull the messages: %w", err)
+		}
+		for _, n := range notifications {
+			c.publishONVIFEvent(n)
+		}
+		if time.Since(renewed) > onvifSubscriptionTerm/2 {
+			renewCtx, cancel := context.WithTimeout(ctx, onvifTimeout)
+			err = sub.Renew(renewCtx, onvifSubscriptionTerm)
+			cancel()
+			if err != nil {
+				return true, fmt.Errorf("cannot renew the subscription: %w", err)
+			}
+			renewed = time.Now()
+		}
+	}
+}
+
+// publishONVIFEvent turns the ONVIF notification into an event of the camera
+func (c *Camera) publishONVIFEvent(n *onvif.Notification) {
+	active, hasState := n.State()
+	if n.Operation == "Initialized" && !active {
+		// The state at the time of subscription: nothing going on
+		return
+	}
+	e := &event.Event{
+		Camera:  string(c.Name),
+		Channel: c.Channel,
+		Type:    n.Type(),
+		Start:   active || !hasState,
+		Time:    time.Now(),
+		Name:    n.Name(),
+	}
+	c.events.Publish(e)
+	if !hasState {
+		// A one-off, e.g. a line crossed: it stops right away
+		stop := *e
+		stop.Start = false
+		c.events.Publish(&stop)
+	}
+}
@@ -0,0 +1,32 @@
+package camera
+
+import (
+	"fmt"
+	"github.com/greendrake/cctv/dvr"
+	"github.com/greendrake/cctv/util"
+	"log"
+	"time"
+)
+
+// PTZ steers the camera (or the NVR channel) over DVRIP
+func (c *Camera) PTZ(r *dvrip.PTZRequest) error {
+	if err := r.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", util.ErrInvalidRequest, err)
+	}
+	if !c.isDVRIP() {
+		return fmt.Errorf("%w: PTZ control is available over DVRIP only", util.ErrNotSupported)
+	}
+	err := c.withDVRIP(func(client *dvrip.Client) error {
+		return client.PTZ(c.Channel, r)
+	})
+	if err == nil && r.Action == dvrip.PTZActionMove && r.DurationMs > 0 {
+		stop := *r
+		stop.Action = dvrip.PTZActionStop
+		time.AfterFunc(time.Duration(r.DurationMs)*time.Millisecond, func() {
+			if err := c.PTZ(&stop); err != nil {
+				log.Printf("Cannot stop PTZ movement of camera %v: %v", c.Name, err)
+			}
+		})
+	}
+	return err
+}
@@ -0,0 +1,134 @@
+package camera
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Schedule is when a stream gets recorded (RecordMode: schedule)
+type Schedule struct {
+	// Time zone of the windows, e.g. "Europe/Berlin". The host's one by default
+	TimeZone string   `yaml:"TimeZone"`
+	Windows  []Window `yaml:"Windows"`
+
+	location *time.Location
+	windows  []window
+}
+
+// Window is a daily time range on some days of the week
+type Window struct {
+	// Mon, Tue, ..., Sun (or full names), Weekdays, Weekend. Every day by default
+	Days []string `yaml:"Days"`
+	// HH:MM (00:00 to 23:59). The start of the day by default
+	From string `yaml:"From"`
+	// HH:MM (00:00 to 24:00). The end of the day by default. If not after From, the window goes on past midnight into the next day.
+	To string `yaml:"To"`
+}
+
+// window is Window parsed: minutes since midnight, and a mask of weekdays (bit 0 is Sunday)
+type window struct {
+	days     uint8
+	from, to int
+}
+
+var weekdays = map[string]uint8{
+	"sun": 1 << time.Sunday, "mon": 1 << time.Monday, "tue": 1 << time.Tuesday, "wed": 1 << time.Wednesday,
+	"thu": 1 << time.Thursday, "fri": 1 << time.Friday, "sat": 1 << time.Saturday,
+	"weekdays": 1<<time.Monday | 1<<time.Tuesday | 1<<time.Wednesday | 1<<time.Thursday | 1<<time.Friday,
+	"weekend":  1<<time.Saturday | 1<<time.Sunday,
+}
+
+const minutesPerDay = 24 * 60
+
+func parseDays(days []string) (uint8, error) {
+	if len(days) == 0 {
+		return 0x7F, nil
+	}
+	var mask uint8
+	for _, d := range days {
+		m, ok := weekdays[strings.ToLower(d)]
+		if !ok {
+			// Full names, e.g. Monday
+			for wd := time.Sunday; wd <= time.Saturday; wd++ {
+				if strings.EqualFold(wd.String(), d) {
+					m, ok = 1<<wd, true
+				}
+			}
+		}
+		if !ok {
+			return 0, fmt.Errorf("unknown day %q", d)
+		}
+		mask |= m
+	}
+	return mask, nil
+}
+
+// parseClock parses HH:MM into minutes since midnight, or returns def if empty
+func parseClock(s string, def int) (int, error) {
+	if s == "" {
+		return def, nil
+	}
+	if s == "24:00" {
+		return minutesPerDay, nil
+	}
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// init validates and parses the schedule
+func (s *Schedule) init() error {
+	s.location = time.Local
+	if s.TimeZone != "" {
+		loc, err := time.LoadLocation(s.TimeZone)
+		if err != nil {
+			return err
+		}
+		s.location = loc
+	}
+	if len(s.Windows) == 0 {
+		return fmt.Errorf("the schedule has no windows")
+	}
+	s.windows = nil
+	for _, w := range s.Windows {
+		var pw window
+		var err error
+		if pw.days, err = parseDays(w.Days); err != nil {
+			return err
+		}
+		if pw.from, err = parseClock(w.From, 0); err != nil {
+			return err
+		}
+		if pw.from == minutesPerDay {
+			// It would start at the end of the day, i.e. wrap into the whole of the next one
+			return fmt.Errorf("invalid From %q, the day ends at 24:00", w.From)
+		}
+		if pw.to, err = parseClock(w.To, minutesPerDay); err != nil {
+			return err
+		}
+		s.windows = append(s.windows, pw)
+	}
+	return nil
+}
+
+// Contains tells whether the time falls into any window of the schedule
+func (s *Schedule) Contains(t time.Time) bool {
+	t = t.In(s.location)
+	m := t.Hour()*60 + t.Minute()
+	today := uint8(1) << t.Weekday()
+	yesterday := uint8(1) << ((t.Weekday() + 6) % 7)
+	for _, w := range s.windows {
+		if w.from < w.to {
+			if w.days&today != 0 && m >= w.from && m < w.to {
+				return true
+			}
+		} else if (w.days&today != 0 && m >= w.from) || (w.days&yesterday != 0 && m < w.to) {
+			// Past midnight
+			return true
+		}
+	}
+	return false
+}
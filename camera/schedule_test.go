@@ -0,0 +1,126 @@
+package camera
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseDays(t *testing.T) {
+	tests := []struct {
+		days []string
+		mask uint8
+		ok   bool
+	}{
+		{nil, 0x7F, true},
+		{[]string{"Mon"}, 1 << time.Monday, true},
+		{[]string{"sun", "SAT"}, 1<<time.Sunday | 1<<time.Saturday, true},
+		{[]string{"Weekdays"}, 0x3E, true},
+		{[]string{"weekend", "Wednesday"}, 1<<time.Sunday | 1<<time.Saturday | 1<<time.Wednesday, true},
+		{[]string{"Someday"}, 0, false},
+	}
+	for _, test := range tests {
+		mask, err := parseDays(test.days)
+		if (err == nil) != test.ok || mask != test.mask {
+			t.Errorf("parseDays(%q): expected %07b (ok: %v), got %07b, %v", test.days, test.mask, test.ok, mask, err)
+		}
+	}
+}
+
+func TestParseClock(t *testing.T) {
+	tests := []struct {
+		s       string
+		minutes int
+		ok      bool
+	}{
+		{"", 42, true},
+		{"00:00", 0, true},
+		{"07:30", 7*60 + 30, true},
+		{"23:59", minutesPerDay - 1, true},
+		{"24:00", minutesPerDay, true},
+		{"24:01", 0, false},
+		{"7pm", 0, false},
+	}
+	for _, test := range tests {
+		minutes, err := parseClock(test.s, 42)
+		if (err == nil) != test.ok || minutes != test.minutes {
+			t.Errorf("parseClock(%q): expected %v (ok: %v), got %v, %v", test.s, test.minutes, test.ok, minutes, err)
+		}
+	}
+}
+
+func TestScheduleInit(t *testing.T) {
+	tests := []struct {
+		window Window
+		ok     bool
+	}{
+		{Window{}, true},
+		{Window{From: "22:00", To: "06:00"}, true},
+		{Window{To: "24:00"}, true},
+		{Window{From: "24:00"}, false},
+		{Window{From: "24:00", To: "06:00"}, false},
+		{Window{Days: []string{"Funday"}}, false},
+	}
+	for _, test := range tests {
+		s := &Schedule{TimeZone: "UTC", Windows: []Window{test.window}}
+		if err := s.init(); (err == nil) != test.ok {
+			t.Errorf("%+v: expected ok: %v, got %v", test.window, test.ok, err)
+		}
+	}
+	if err := (&Schedule{}).init(); err == nil {
+		t.Errorf("A schedule with no windows must be invalid")
+	}
+}
+
+func TestScheduleContains(t *testing.T) {
+	// 2024-01-01 is a Monday
+	at := func(day int, hour int, minute int) time.Time {
+		return time.Date(2024, 1, day, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		name     string
+		windows  []Window
+		t        time.Time
+		contains bool
+	}{
+		{"every day, all day", []Window{{}}, at(3, 12, 0), true},
+		{"daytime, inside", []Window{{From: "08:00", To: "18:00"}}, at(1, 8, 0), true},
+		{"daytime, end excluded", []Window{{From: "08:00", To: "18:00"}}, at(1, 18, 0), false},
+		{"daytime, before", []Window{{From: "08:00", To: "18:00"}}, at(1, 7, 59), false},
+		{"to the end of the day", []Window{{From: "20:00", To: "24:00"}}, at(1, 23, 59), true},
+		{"to the end of the day, not past midnight", []Window{{From: "20:00", To: "24:00"}}, at(2, 0, 0), false},
+		{"weekdays, on Friday", []Window{{Days: []string{"Weekdays"}}}, at(5, 12, 0), true},
+		{"weekdays, on Saturday", []Window{{Days: []string{"Weekdays"}}}, at(6, 12, 0), false},
+		// Overnight windows belong to the day they start on
+		{"overnight, evening", []Window{{Days: []string{"Fri"}, From: "22:00", To: "06:00"}}, at(5, 23, 0), true},
+		{"overnight, morning after", []Window{{Days: []string{"Fri"}, From: "22:00", To: "06:00"}}, at(6, 5, 59), true},
+		{"overnight, end excluded", []Window{{Days: []string{"Fri"}, From: "22:00", To: "06:00"}}, at(6, 6, 0), false},
+		{"overnight, morning of the start day", []Window{{Days: []string{"Fri"}, From: "22:00", To: "06:00"}}, at(5, 5, 0), false},
+		{"overnight, evening of the day after", []Window{{Days: []string{"Fri"}, From: "22:00", To: "06:00"}}, at(6, 23, 0), false},
+		// Sunday night into Monday: yesterday of Monday wraps to Sunday
+		{"overnight across the week", []Window{{Days: []string{"Sun"}, From: "22:00", To: "02:00"}}, at(1, 1, 0), true},
+		{"overnight across the week, Saturday night", []Window{{Days: []string{"Sun"}, From: "22:00", To: "02:00"}}, at(7, 1, 0), false},
+		{"From equal to To is the whole day on", []Window{{Days: []string{"Mon"}, From: "08:00", To: "08:00"}}, at(2, 7, 59), true},
+		{"From equal to To, ended", []Window{{Days: []string{"Mon"}, From: "08:00", To: "08:00"}}, at(2, 8, 0), false},
+		{"any of the windows", []Window{{From: "01:00", To: "02:00"}, {From: "03:00", To: "04:00"}}, at(1, 3, 30), true},
+	}
+	for _, test := range tests {
+		s := &Schedule{TimeZone: "UTC", Windows: test.windows}
+		if err := s.init(); err != nil {
+			t.Fatalf("%v: %v", test.name, err)
+		}
+		if contains := s.Contains(test.t); contains != test.contains {
+			t.Errorf("%v: Contains(%v) expected %v, got %v", test.name, test.t.Format(time.DateTime), test.contains, contains)
+		}
+	}
+}
+
+func TestScheduleTimeZone(t *testing.T) {
+	s := &Schedule{TimeZone: "Pacific/Auckland", Windows: []Window{{Days: []string{"Mon"}, From: "08:00", To: "09:00"}}}
+	if err := s.init(); err != nil {
+		t.Fatal(err)
+	}
+	// Monday 08:30 in Auckland (NZDT, UTC+13) is Sunday 19:30 UTC
+	if !s.Contains(time.Date(2024, 1, 7, 19, 30, 0, 0, time.UTC)) {
+		t.Errorf("The windows must be in the time zone of the schedule")
+	}
+}
@@ -0,0 +1,103 @@
+package camera
+
+import (
+	"fmt"
+	"github.com/greendrake/cctv/dvr"
+	"github.com/greendrake/cctv/util"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	snapshotDir           = "snapshots"
+	snapshotTimeLayout    = "2006/01/02/15-04-05"
+	defaultSnapshotMaxAge = 7 * 24 * time.Hour
+	snapshotPruneInterval = time.Hour
+)
+
+// Snapshot takes a still picture (JPEG) over DVRIP
+func (c *Camera) Snapshot() ([]byte, error) {
+	if !c.isDVRIP() {
+		return nil, fmt.Errorf("%w: snapshots are available over DVRIP only", util.ErrNotSupported)
+	}
+	var jpeg []byte
+	err := c.withDVRIP(func(client *dvrip.Client) (err error) {
+		jpeg, err = client.Snapshot(c.Channel)
+		return
+	})
+	return jpeg, err
+}
+
+// maybeArchiveSnapshot archives a snapshot if it is time to (SnapshotInterval).
+// A tick due while the previous snapshot is still being taken is skipped.
+func (c *Camera) maybeArchiveSnapshot(now time.Time) {
+	if c.SnapshotInterval <= 0 || now.Before(c.nextSnapshot) {
+		return
+	}
+	c.nextSnapshot = now.Truncate(c.SnapshotInterval).Add(c.SnapshotInterval)
+	if !c.archivingSnapshot.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer c.archivingSnapshot.Store(false)
+		c.archiveSnapshot(now)
+	}()
+}
+
+// archiveSnapshot saves a snapshot as <camera>/snapshots/YYYY/MM/DD/hh-mm-ss.jpg, and deletes the expired ones
+func (c *Camera) archiveSnapshot(t time.Time) {
+	jpeg, err := c.Snapshot()
+	if err != nil {
+		log.Printf("%v: cannot take a snapshot: %v", c.GetNode().ID, err)
+		return
+	}
+	path := filepath.Join(c.dstDir, snapshotDir, t.Format(snapshotTimeLayout)+".jpg")
+	if err = os.MkdirAll(filepath.Dir(path), os.ModePerm); err == nil {
+		err = os.WriteFile(path, jpeg, 0644)
+	}
+	if err != nil {
+		log.Printf("%v: cannot save the snapshot: %v", c.GetNode().ID, err)
+	}
+	if t.Sub(c.lastSnapshotPrune) >= snapshotPruneInterval {
+		c.lastSnapshotPrune = t
+		c.pruneSnapshots(t)
+	}
+}
+
+// pruneSnapshots deletes the archived snapshots older than SnapshotMaxAge, along with the directories left empty
+func (c *Camera) pruneSnapshots(now time.Time) {
+	maxAge := c.SnapshotMaxAge
+	if maxAge <= 0 {
+		maxAge = defaultSnapshotMaxAge
+	}
+	root := filepath.Join(c.dstDir, snapshotDir)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return nil
+		}
+		t, err := time.ParseInLocation(snapshotTimeLayout+".jpg", filepath.ToSlash(rel), time.Local)
+		if err != nil || now.Sub(t) < maxAge {
+			return nil
+		}
+		if err := os.Remove(path); err != nil {
+			log.Printf("%v: cannot delete %v: %v", c.GetNode().ID, path, err)
+			return nil
+		}
+		dir := filepath.Dir(path)
+		for i := 0; i < 3 && dir != root; i++ {
+			// Fails (harmlessly) if the directory is not empty
+			if os.Remove(dir) != nil {
+				break
+			}
+			dir = filepath.Dir(dir)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,87 @@
+package camera
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// Built-in sources
+const (
+	SourceDVRIP = "dvrip"
+	SourceRTSP  = "rtsp"
+)
+
+// MonitorFactory makes a monitor pulling the stream of the camera. ctx is done when the stream stops.
+// The options of the source are in the SourceOptions of the camera. A *util.WrongCredentialsError
+// disables the camera; on any other error the factory is called again shortly.
+type MonitorFactory func(ctx context.Context, c *Camera, sId StreamID) (Monitor, error)
+
+var (
+	sourcesMutex sync.RWMutex
+	sources      = map[string]MonitorFactory{}
+)
+
+func init() {
+	RegisterSource(SourceDVRIP, newDVRIPMonitor)
+	RegisterSource(SourceRTSP, newRTSPMonitor)
+}
+
+// RegisterSource makes the source available to the cameras (or streams) configured with Source: name (case-insensitive).
+// It is meant to be called from the init function of the package implementing the source, before the cameras are loaded.
+// Registering a name twice panics.
+func RegisterSource(name string, f MonitorFactory) {
+	name = strings.ToLower(name)
+	sourcesMutex.Lock()
+	defer sourcesMutex.Unlock()
+	if f == nil {
+		panic("camera: nil MonitorFactory for source " + name)
+	}
+	if _, ok := sources[name]; ok {
+		panic("camera: source " + name + " registered twice")
+	}
+	sources[name] = f
+}
+
+// Sources lists the names of the registered sources
+func Sources() []string {
+	sourcesMutex.RLock()
+	defer sourcesMutex.RUnlock()
+	return slices.Sorted(maps.Keys(sources))
+}
+
+func lookupSource(name string) (MonitorFactory, bool) {
+	sourcesMutex.RLock()
+	defer sourcesMutex.RUnlock()
+	f, ok := sources[name]
+	return f, ok
+}
+
+// cameraSource is the source of the streams of the camera, unless overridden per stream
+func (c *Camera) cameraSource() string {
+	if c.Source != "" {
+		return strings.ToLower(c.Source)
+	}
+	if c.rtspOnly() || c.UseRTSP {
+		return SourceRTSP
+	}
+	return SourceDVRIP
+}
+
+// streamSource is the source the stream is pulled from
+func (c *Camera) streamSource(sId StreamID) string {
+	for _, s := range c.Streams {
+		if s.ID == sId {
+			if s.Source != "" {
+				return strings.ToLower(s.Source)
+			}
+			if s.UseRTSP {
+				return SourceRTSP
+			}
+			break
+		}
+	}
+	return c.cameraSource()
+}
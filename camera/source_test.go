@@ -0,0 +1,62 @@
+package camera
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+)
+
+// Streams the test source has been asked for
+var testSourceCalls []StreamID
+
+func init() {
+	RegisterSource("Test", func(ctx context.Context, c *Camera, sId StreamID) (Monitor, error) {
+		testSourceCalls = append(testSourceCalls, sId)
+		return nil, errors.New("offline")
+	})
+}
+
+func TestSources(t *testing.T) {
+	testSourceCalls = nil
+	if !slices.Contains(Sources(), "test") {
+		t.Fatalf("expected the registered source in %v", Sources())
+	}
+
+	tests := []struct {
+		name    string
+		source  string
+		streams []StreamConfig
+		save    []StreamID
+		webCast []StreamID
+	}{
+		// The whole camera from an unknown source
+		{"nosuch", "nosuch", nil, nil, nil},
+		// One stream from an unknown source
+		{"override", "", []StreamConfig{{ID: StreamExtra, Source: "nosuch"}}, []StreamID{StreamMain}, []StreamID{StreamMain}},
+		// One stream from the registered source, named in any case
+		{"custom", "", []StreamConfig{{ID: StreamExtra, Source: "TEST"}}, []StreamID{StreamMain, StreamExtra}, []StreamID{StreamMain, StreamExtra}},
+	}
+	for _, test := range tests {
+		c := &Camera{
+			Name:    CamName(test.name),
+			Source:  test.source,
+			Streams: test.streams,
+			Save:    []StreamID{StreamMain, StreamExtra},
+			WebCast: []StreamID{StreamMain, StreamExtra},
+		}
+		c.Init(t.TempDir(), nil, nil)
+		if !slices.Equal(c.Save, test.save) || !slices.Equal(c.WebCast, test.webCast) {
+			t.Errorf("%v: expected Save %v and WebCast %v, got %v and %v", test.name, test.save, test.webCast, c.Save, c.WebCast)
+		}
+	}
+
+	c := &Camera{Streams: []StreamConfig{{ID: StreamExtra, Source: "TEST"}}}
+	if source := c.streamSource(StreamMain); source != SourceDVRIP {
+		t.Errorf("expected main stream from %v, got %v", SourceDVRIP, source)
+	}
+	s := &Stream{ID: StreamExtra, camera: c}
+	if s.tryToMakeMonitor() || !slices.Equal(testSourceCalls, []StreamID{StreamExtra}) {
+		t.Errorf("expected one failed call of the registered source for stream %v, got %v", StreamExtra, testSourceCalls)
+	}
+}
@@ -0,0 +1,40 @@
+package camera
+
+import (
+	"context"
+	"fmt"
+	"github.com/greendrake/cctv/dvr"
+	"github.com/greendrake/cctv/util"
+	"github.com/greendrake/cctv/webcast"
+)
+
+// talk passes the audio to the device, and frees the camera for the next talk when done
+type talk struct {
+	*dvrip.Talk
+	camera *Camera
+}
+
+func (t *talk) Close() {
+	t.Talk.Close()
+	t.camera.talking.Store(false)
+}
+
+// Talk claims the speaker of the camera (talkback, e.g. to use it as an intercom). One talk at a time.
+func (c *Camera) Talk() (webcast.Talker, error) {
+	if !c.isDVRIP() {
+		return nil, fmt.Errorf("%w: talkback is available over DVRIP only", util.ErrNotSupported)
+	}
+	if c.talking.Swap(true) {
+		return nil, fmt.Errorf("%w: someone is talking through it already", util.ErrBusy)
+	}
+	session, err := dvrip.AcquireSession(context.Background(), c.Address, c.User, c.Password)
+	if err == nil {
+		var t *dvrip.Talk
+		if t, err = session.Talk(context.Background()); err == nil {
+			return &talk{t, c}, nil
+		}
+		session.Release()
+	}
+	c.talking.Store(false)
+	return nil, err
+}
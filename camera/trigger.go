@@ -0,0 +1,75 @@
+package camera
+
+import (
+	"fmt"
+	"github.com/greendrake/cctv/event"
+	"sync"
+	"time"
+)
+
+// Events still going on after this long are deemed stopped, in case their end has not been reported
+const maxEventDuration = 10 * time.Minute
+
+// eventTrigger tells when a stream recorded in the events mode should be written: while any event
+// of the camera goes on, and for the post-roll after. Overlapping events thus make one clip.
+type eventTrigger struct {
+	postRoll time.Duration
+	mutex    sync.Mutex
+	// Events going on (by type, name and channel), with their start time
+	ongoing map[string]time.Time
+	// End of the post-roll of the latest event
+	until time.Time
+	// The event that started the current clip
+	cause *event.Event
+}
+
+func newEventTrigger(postRoll time.Duration) *eventTrigger {
+	return &eventTrigger{
+		postRoll: postRoll,
+		ongoing:  map[string]time.Time{},
+	}
+}
+
+func (t *eventTrigger) handle(e *event.Event) {
+	t.handleAt(e, time.Now())
+}
+
+func (t *eventTrigger) handleAt(e *event.Event, now time.Time) {
+	key := fmt.Sprintf("%v/%v/%v", e.Type, e.Name, e.Channel)
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if e.Start {
+		if !t.isActive(now) {
+			t.cause = e
+		}
+		t.ongoing[key] = now
+	} else {
+		if _, ok := t.ongoing[key]; !ok {
+			// A stop with no start (or a repeated one) ends nothing
+			return
+		}
+		delete(t.ongoing, key)
+	}
+	if until := now.Add(t.postRoll); until.After(t.until) {
+		t.until = until
+	}
+}
+
+// active tells whether to record at the time, and if so, the event that started the clip
+func (t *eventTrigger) active(now time.Time) (bool, *event.Event) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.isActive(now), t.cause
+}
+
+func (t *eventTrigger) isActive(now time.Time) bool {
+	active := now.Before(t.until)
+	for key, start := range t.ongoing {
+		if now.Sub(start) < maxEventDuration {
+			active = true
+		} else {
+			delete(t.ongoing, key)
+		}
+	}
+	return active
+}
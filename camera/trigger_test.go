@@ -0,0 +1,93 @@
+package camera
+
+import (
+	"testing"
+	"time"
+
+	"github.com/greendrake/cctv/event"
+	"github.com/greendrake/cctv/frame"
+)
+
+func TestEventTrigger(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+	motion := func(start bool) *event.Event {
+		return &event.Event{Type: event.Motion, Name: "VideoMotion", Start: start}
+	}
+	input := func(start bool) *event.Event {
+		return &event.Event{Type: event.Input, Name: "LocalAlarm", Start: start}
+	}
+
+	// Overlapping events make one clip, caused by the first of them
+	tr := newEventTrigger(10 * time.Second)
+	first := motion(true)
+	tr.handleAt(first, at(0))
+	tr.handleAt(input(true), at(5))
+	tr.handleAt(motion(false), at(8))
+	tr.handleAt(input(false), at(20))
+	for _, s := range []int{0, 10, 20, 29} {
+		if active, cause := tr.active(at(s)); !active || cause != first {
+			t.Errorf("merged events at %vs: expected active by %v, got %v by %v", s, first, active, cause)
+		}
+	}
+	if active, _ := tr.active(at(30)); active {
+		t.Errorf("merged events at 30s: expected inactive after the post-roll")
+	}
+	// The next clip has a cause of its own
+	next := input(true)
+	tr.handleAt(next, at(60))
+	if active, cause := tr.active(at(60)); !active || cause != next {
+		t.Errorf("next event: expected active by %v, got %v by %v", next, active, cause)
+	}
+
+	// A stop with no start does not start a clip
+	tr = newEventTrigger(10 * time.Second)
+	tr.handleAt(motion(false), at(0))
+	if active, cause := tr.active(at(1)); active || cause != nil {
+		t.Errorf("stray stop: expected inactive, got %v by %v", active, cause)
+	}
+	// Nor does a repeated stop extend the post-roll
+	tr.handleAt(motion(true), at(10))
+	tr.handleAt(motion(false), at(12))
+	tr.handleAt(motion(false), at(20))
+	if active, _ := tr.active(at(23)); active {
+		t.Errorf("repeated stop: expected inactive at 23s")
+	}
+
+	// Events never reported stopped time out
+	tr = newEventTrigger(0)
+	tr.handleAt(motion(true), at(0))
+	if active, _ := tr.active(at(0).Add(maxEventDuration)); active {
+		t.Errorf("unstopped event: expected inactive after %v", maxEventDuration)
+	}
+}
+
+func TestBufferFrame(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	w := &MKVWriter{preRoll: 3 * time.Second}
+	frames := map[*frame.Frame]int{}
+	// One frame a second, a key frame every 2 seconds from 1s on
+	for s := 0; s <= 8; s++ {
+		f := &frame.Frame{IsVideo: true, IsVideoKeyFrame: s%2 == 1}
+		frames[f] = s
+		w.bufferFrame(f, t0.Add(time.Duration(s)*time.Second))
+		if s == 0 && len(w.buffered) != 0 {
+			t.Errorf("expected frames before the first key frame to be dropped, got %v buffered", len(w.buffered))
+		}
+	}
+	// The pre-roll reaches back to 5s, so the buffer starts at the key frame at or before it
+	var got []int
+	for _, b := range w.buffered {
+		got = append(got, frames[b.f])
+	}
+	expected := []int{5, 6, 7, 8}
+	if len(got) != len(expected) {
+		t.Fatalf("expected buffered frames %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Errorf("expected buffered frames %v, got %v", expected, got)
+			break
+		}
+	}
+}
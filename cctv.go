@@ -1,10 +1,14 @@
 package main
 
 import (
-	// "time"
 	"context"
 	"fmt"
 	"github.com/greendrake/cctv/camera"
+	"github.com/greendrake/cctv/dvr"
+	"github.com/greendrake/cctv/event"
+	"github.com/greendrake/cctv/recindex"
+	"github.com/greendrake/cctv/retention"
+	"github.com/greendrake/cctv/util"
 	"github.com/greendrake/cctv/webcast"
 	"github.com/greendrake/server_client_hierarchy"
 	"gopkg.in/yaml.v3"
@@ -15,37 +19,194 @@ import (
 	"strconv"
 	"strings"
 	"syscall"
+	"time"
 )
 
 // The top node for holding and puppet-mastering all Camera nodes
 type CCTV struct {
 	server_client_hierarchy.Node
 	webCastIDs []string
+	index      *recindex.Index
+	events     *event.Bus
 }
 
-func New(ctx context.Context, camSet map[camera.CamName]*camera.Camera, baseDir string, WebCastPort string) *CCTV {
+type Config struct {
+	BaseDir     string           `yaml:"BaseDir"`
+	WebCastPort string           `yaml:"WebCastPort"`
+	Retention   retention.Config `yaml:"Retention"`
+	Cameras     []*camera.Camera `yaml:"Cameras"`
+}
+
+func New(ctx context.Context, camSet map[camera.CamName]*camera.Camera, config *Config) *CCTV {
 	cctv := &CCTV{}
 	cctv.GetNode().ID = "CCTV"
+	cctv.events = &event.Bus{}
+	cctv.events.Subscribe(func(e *event.Event) {
+		log.Printf("Event: %v", e)
+	})
 	cctv.SetContextWaiter(ctx)
+	cctv.openIndex(config, camSet)
+	var retentionTargets []*retention.Target
+	// The cameras running, which the HTTP API controls. The others are not initialised.
+	cams := map[camera.CamName]*camera.Camera{}
 	for _, cam := range camSet {
 		if cam.HasAnythingToDo() {
+			cam.Init(config.BaseDir, cctv.index, cctv.events)
+			cams[cam.Name] = cam
 			for _, sId := range cam.WebCast {
 				cctv.webCastIDs = append(cctv.webCastIDs, fmt.Sprintf("%v/%v", cam.Name, sId))
 			}
-			cam.Init(baseDir)
 			cctv.AddClient(cam)
 		}
+		// Old recordings of currently disabled cameras are subject to retention too
+		retentionTargets = append(retentionTargets, &retention.Target{
+			Name:   string(cam.Name),
+			Dir:    camera.GetDstDir(config.BaseDir, cam.Name),
+			Policy: cam.Retention,
+		})
 	}
-	if len(cctv.webCastIDs) > 0 {
+	janitor := retention.NewJanitor(config.Retention, retentionTargets, cctv.index)
+	if janitor.HasAnythingToDo() {
+		cctv.AddClient(janitor)
+	}
+	if len(cctv.webCastIDs) > 0 || (cctv.index != nil && config.WebCastPort != "") {
 		casterGetter := func(cam string, ssId string) *webcast.Caster {
 			sId, _ := strconv.Atoi(ssId)
-			return camSet[camera.CamName(cam)].GetStream(camera.StreamID(sId)).GetCaster()
+			return cams[camera.CamName(cam)].GetStream(camera.StreamID(sId)).GetCaster()
 		}
-		go webcast.Run(ctx, WebCastPort, cctv.webCastIDs, casterGetter)
+		go webcast.Run(ctx, &webcast.Options{
+			Port:         config.WebCastPort,
+			StreamIDs:    cctv.webCastIDs,
+			CasterGetter: casterGetter,
+			Index:        cctv.index,
+			BaseDir:      config.BaseDir,
+			PTZ: func(cam string, r *webcast.PTZRequest) error {
+				c, ok := cams[camera.CamName(cam)]
+				if !ok {
+					return util.ErrUnknownCamera
+				}
+				return c.PTZ(&dvrip.PTZRequest{
+					Action:     r.Action,
+					Movement:   r.Movement,
+					Speed:      r.Speed,
+					Preset:     r.Preset,
+					Tour:       r.Tour,
+					DurationMs: r.DurationMs,
+				})
+			},
+			Trigger: func(cam string, duration time.Duration) error {
+				c, ok := cams[camera.CamName(cam)]
+				if !ok {
+					return util.ErrUnknownCamera
+				}
+				e := event.Event{
+					Camera:  cam,
+					Channel: c.Channel,
+					Type:    event.Manual,
+					Start:   true,
+					Time:    time.Now(),
+					Name:    "HTTP",
+				}
+				cctv.events.Publish(&e)
+				stop := e
+				stop.Start = false
+				time.AfterFunc(duration, func() {
+					stop.Time = time.Now()
+					cctv.events.Publish(&stop)
+				})
+				return nil
+			},
+			Snapshot: func(cam string) ([]byte, error) {
+				c, ok := cams[camera.CamName(cam)]
+				if !ok {
+					return nil, util.ErrUnknownCamera
+				}
+				return c.Snapshot()
+			},
+			Info: func(cam string) (*webcast.DeviceInfo, error) {
+				c, ok := cams[camera.CamName(cam)]
+				if !ok {
+					return nil, util.ErrUnknownCamera
+				}
+				info, err := c.DeviceInfo()
+				if err != nil {
+					return nil, err
+				}
+				return webcastDeviceInfo(info), nil
+			},
+			Talk: func(cam string) (webcast.Talker, error) {
+				c, ok := cams[camera.CamName(cam)]
+				if !ok {
+					return nil, util.ErrUnknownCamera
+				}
+				return c.Talk()
+			},
+		})
 	}
 	return cctv
 }
 
+// webcastDeviceInfo tells the HTTP API what the DVRIP device is
+func webcastDeviceInfo(info *dvrip.DeviceInfo) *webcast.DeviceInfo {
+	return &webcast.DeviceInfo{
+		System: &webcast.SystemInfo{
+			Model:           info.System.Model,
+			SerialNo:        info.System.SerialNo,
+			Firmware:        info.System.Firmware,
+			Hardware:        info.System.Hardware,
+			BuildTime:       info.System.BuildTime,
+			VideoInChannels: info.System.VideoInChannels,
+			DigitalChannels: info.System.DigitalChannels,
+			ExtraChannels:   info.System.ExtraChannels,
+			AudioInChannels: info.System.AudioInChannels,
+			AlarmInputs:     info.System.AlarmInputs,
+		},
+		Capabilities: &webcast.Capabilities{
+			Streams:   info.Capabilities.Streams,
+			Codecs:    info.Capabilities.Codecs,
+			Functions: info.Capabilities.Functions,
+		},
+	}
+}
+
+// openIndex opens the index of recordings, which is optional: the service carries on without it if it fails.
+// A new index gets populated from the existing recordings in the background.
+// Chunks left unfinalized by a crash are repaired before any recording starts.
+func (cctv *CCTV) openIndex(config *Config, camSet map[camera.CamName]*camera.Camera) {
+	if err := os.MkdirAll(config.BaseDir, os.ModePerm); err != nil {
+		log.Printf("Cannot create %v: %v", config.BaseDir, err)
+		return
+	}
+	index, isNew, err := recindex.Open(filepath.Join(config.BaseDir, recindex.FileName))
+	if err != nil {
+		log.Printf("Cannot open the index of recordings, continuing without it: %v", err)
+		return
+	}
+	cctv.index = index
+	cctv.On("stop", func(args ...any) {
+		index.Close()
+	})
+	if isNew {
+		var names []string
+		for name := range camSet {
+			names = append(names, string(name))
+		}
+		// Without the index there is no telling which chunks were open, so check them all
+		if err := recindex.RepairChunks(config.BaseDir, names); err != nil {
+			log.Printf("Cannot repair the recordings: %v", err)
+		}
+		// The cameras start recording meanwhile, indexing their new chunks themselves
+		startup := time.Now()
+		go func() {
+			if err := index.IndexChunks(config.BaseDir, names, startup); err != nil {
+				log.Printf("Cannot rebuild the index of recordings: %v", err)
+			}
+		}()
+	} else if err := index.RepairOpen(config.BaseDir); err != nil {
+		log.Printf("Cannot repair the index of recordings: %v", err)
+	}
+}
+
 func GetWorkDir() string {
 	ex, err := os.Executable()
 	if err != nil {
@@ -60,17 +221,8 @@ func GetWorkDir() string {
 	return filepath.Dir(ex)
 }
 
-func main() {
-	// Log to STDOUT in the standard manner
-	log.SetOutput(os.Stdout)
-	log.SetFlags(log.LstdFlags | log.LUTC)
-
-	err := os.Chdir(GetWorkDir())
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	// Read camera configuration from YAML file "config.yaml"
+// readConfig reads camera configuration from YAML file "config.yaml", exiting if it cannot
+func readConfig() *Config {
 	configFile := "config.yaml"
 	f, err := os.Open(configFile)
 	if err != nil {
@@ -78,16 +230,39 @@ func main() {
 	}
 	defer f.Close()
 
-	var config struct {
-		BaseDir     string           `yaml:"BaseDir"`
-		WebCastPort string           `yaml:"WebCastPort"`
-		Cameras     []*camera.Camera `yaml:"Cameras"`
-	}
+	var config Config
 
 	decoder := yaml.NewDecoder(f)
 	if err := decoder.Decode(&config); err != nil {
 		log.Fatalf("Failed to parse YAML config: %v", err)
 	}
+	return &config
+}
+
+func main() {
+	// Log to STDOUT in the standard manner
+	log.SetOutput(os.Stdout)
+	log.SetFlags(log.LstdFlags | log.LUTC)
+
+	invocationDir, _ = os.Getwd()
+	err := os.Chdir(GetWorkDir())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(os.Args) > 1 {
+		// Commands helping to make the config run without it
+		var config *Config
+		if !commandsWithoutConfig[os.Args[1]] {
+			config = readConfig()
+		}
+		if err := runCommand(config, os.Args[1], os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	config := readConfig()
 
 	cams := config.Cameras
 	camLen := len(cams)
@@ -108,12 +283,10 @@ func main() {
 			}
 		}
 		if anythingToDo {
-			baseDir := config.BaseDir
-			WebCastPort := config.WebCastPort
 			// We've got some properly configured cameras, hence some real job to do.
 			// Create a context that is responsive to signals:
 			ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
-			cctv := New(ctx, camSet, baseDir, WebCastPort)
+			cctv := New(ctx, camSet, config)
 			defer func() {
 				log.Println("All finished")
 				stop()
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/greendrake/cctv/discovery"
+	"github.com/greendrake/cctv/export"
+	"github.com/greendrake/cctv/recindex"
+	"github.com/greendrake/cctv/util"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// The directory the app was started from (before switching to its work dir), so that relative paths given
+// on the command line work as expected
+var invocationDir string
+
+// Commands that can be run instead of the service by giving their name as the first command line argument
+var commands = map[string]func(config *Config, args []string) error{
+	"reindex":  reindexCommand,
+	"export":   exportCommand,
+	"discover": discoverCommand,
+}
+
+// Commands which do not need config.yaml (given nil config), as they help making it
+var commandsWithoutConfig = map[string]bool{
+	"discover": true,
+}
+
+func runCommand(config *Config, name string, args []string) error {
+	command, ok := commands[name]
+	if !ok {
+		var names []string
+		for n := range commands {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("Unknown command %q. Available commands: %v", name, strings.Join(names, ", "))
+	}
+	return command(config, args)
+}
+
+// reindexCommand rebuilds the index of recordings by scanning the MKV files of all (or the given) cameras,
+// finalizing the files left unfinalized by crashes on the way.
+// Usage: cctv reindex [camera...]
+func reindexCommand(config *Config, args []string) error {
+	index, _, err := recindex.Open(filepath.Join(config.BaseDir, recindex.FileName))
+	if err != nil {
+		return err
+	}
+	defer index.Close()
+	names := args
+	if len(names) == 0 {
+		for _, cam := range config.Cameras {
+			names = append(names, string(cam.Name))
+		}
+	}
+	// The index is locked by the service while it runs, so nothing is recording now
+	if err := recindex.RepairChunks(config.BaseDir, names); err != nil {
+		return err
+	}
+	return index.Rebuild(config.BaseDir, names)
+}
+
+// exportCommand cuts a time range out of the recordings into a single MKV or MP4 file (by the file extension, MP4 without audio).
+// Usage: cctv export <camera> <stream> <from> <to> <file>
+func exportCommand(config *Config, args []string) error {
+	if len(args) != 5 {
+		return errors.New("Usage: cctv export <camera> <stream> <from> <to> <file>")
+	}
+	cam, stream, path := args[0], args[1], args[4]
+	from, err := util.ParseTime(args[2])
+	if err != nil {
+		return err
+	}
+	to, err := util.ParseTime(args[3])
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(invocationDir, path)
+	}
+	var recs []*recindex.Recording
+	index, _, err := recindex.Open(filepath.Join(config.BaseDir, recindex.FileName))
+	if err == nil {
+		recs, err = index.Query(cam, stream, from, to)
+		index.Close()
+	} else if err == recindex.ErrLocked {
+		// The service is running: find the chunks without the index
+		recs, err = recindex.ScanRange(config.BaseDir, cam, stream, from, to)
+	}
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = export.Export(config.BaseDir, recs, from, to, export.FormatFromFileName(path), f)
+	f.Close()
+	if err != nil {
+		os.Remove(path)
+		return err
+	}
+	log.Printf("Exported %v", path)
+	return nil
+}
+
+// discoverCommand lists the DVRIP and ONVIF devices on the LAN, or, with -yaml, prints their camera configuration
+// to be pasted into config.yaml. The devices are waited for 3 seconds by default.
+// Usage: cctv discover [-yaml] [timeout]
+func discoverCommand(config *Config, args []string) error {
+	asYAML := false
+	timeout := 3 * time.Second
+	for _, arg := range args {
+		if arg == "-yaml" {
+			asYAML = true
+		} else if d, err := time.ParseDuration(arg); err == nil && d > 0 {
+			timeout = d
+		} else {
+			return errors.New("Usage: cctv discover [-yaml] [timeout]")
+		}
+	}
+	// Both searches at once, either may fail (e.g. the DVRIP port being taken)
+	var onvifDevices []*discovery.Device
+	var onvifErr error
+	done := make(chan bool)
+	go func() {
+		onvifDevices, onvifErr = discovery.DiscoverONVIF(context.Background(), timeout)
+		close(done)
+	}()
+	devices, err := discovery.DiscoverDVRIP(context.Background(), timeout)
+	<-done
+	if err != nil && onvifErr != nil {
+		return fmt.Errorf("%v; %v", err, onvifErr)
+	}
+	for _, e := range []error{err, onvifErr} {
+		if e != nil {
+			log.Printf("Search failed: %v", e)
+		}
+	}
+	devices = append(devices, onvifDevices...)
+	if len(devices) == 0 {
+		log.Println("No devices found")
+		return nil
+	}
+	if asYAML {
+		out, err := discovery.CamerasYAML(devices)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "PROTOCOL\tIP\tMAC\tNAME\tMODEL\tSERIAL NUMBER\tCHANNELS\tTCP PORT\tHTTP PORT\tFIRMWARE")
+	for _, d := range devices {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\t%v\n", d.Protocol, d.IP, d.MAC, d.Name, d.Model, d.SerialNumber, d.Channels, d.TCPPort, d.HTTPPort, d.Firmware)
+	}
+	return w.Flush()
+}
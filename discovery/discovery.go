@@ -0,0 +1,199 @@
+// Package discovery finds cameras on the LAN
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// Sofia (DVRIP) devices answer the search broadcast to this port, broadcasting back to it
+const dvripSearchPort = 34569
+
+const (
+	ProtocolDVRIP = "DVRIP"
+	ProtocolONVIF = "ONVIF"
+)
+
+// Device is a camera (or NVR) found on the LAN
+type Device struct {
+	Protocol     string `json:"protocol"`
+	Name         string `json:"name"`
+	Model        string `json:"model,omitempty"`
+	MAC          string `json:"mac"`
+	IP           string `json:"ip"`
+	Mask         string `json:"mask,omitempty"`
+	Gateway      string `json:"gateway,omitempty"`
+	SerialNumber string `json:"serialNumber,omitempty"`
+	Firmware     string `json:"firmware,omitempty"`
+	Channels     int    `json:"channels,omitempty"`
+	// Media (DVRIP) and web ports
+	TCPPort  int `json:"tcpPort,omitempty"`
+	UDPPort  int `json:"udpPort,omitempty"`
+	HTTPPort int `json:"httpPort,omitempty"`
+	SSLPort  int `json:"sslPort,omitempty"`
+	// URL of the ONVIF device service (ONVIF only)
+	ONVIF string `json:"onvif,omitempty"`
+}
+
+// DiscoverDVRIP broadcasts the DVRIP search over the LAN, and returns the devices that answer it within the timeout,
+// by IP address
+func DiscoverDVRIP(ctx context.Context, timeout time.Duration) ([]*Device, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: dvripSearchPort})
+	if err != nil {
+		return nil, fmt.Errorf("Cannot listen on UDP port %v: %w", dvripSearchPort, err)
+	}
+	defer conn.Close()
+	var probe bytes.Buffer
+	binary.Write(&probe, binary.LittleEndian, packet.Header{
+		HeadFlag: 255,
+		Code:     packet.IPSEARCH_REQ,
+	})
+	sent := false
+	for _, addr := range broadcastAddresses() {
+		if _, err := conn.WriteToUDP(probe.Bytes(), &net.UDPAddr{IP: addr, Port: dvripSearchPort}); err == nil {
+			sent = true
+		}
+	}
+	if !sent {
+		return nil, errors.New("Cannot broadcast the search")
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	found := map[string]*Device{}
+	buf := make([]byte, 4096)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		if d := parseSearchResponse(buf[:n]); d != nil {
+			found[d.MAC] = d
+		}
+	}
+	devices := make([]*Device, 0, len(found))
+	for _, d := range found {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return compareIPs(devices[i].IP, devices[j].IP) < 0
+	})
+	return devices, nil
+}
+
+func compareIPs(a string, b string) int {
+	return bytes.Compare(net.ParseIP(a).To16(), net.ParseIP(b).To16())
+}
+
+// broadcastAddresses returns the broadcast addresses of the IPv4 networks of the host, and the limited broadcast one
+func broadcastAddresses() []net.IP {
+	addrs := []net.IP{net.IPv4bcast}
+	ifaces, _ := net.Interfaces()
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 {
+			continue
+		}
+		ifAddrs, _ := iface.Addrs()
+		for _, a := range ifAddrs {
+			ipNet, ok := a.(*net.IPNet)
+			if !ok || ipNet.IP.To4() == nil {
+				continue
+			}
+			ip, mask := ipNet.IP.To4(), net.IP(ipNet.Mask).To4()
+			if mask == nil {
+				continue
+			}
+			bcast := make(net.IP, 4)
+			for i := range bcast {
+				bcast[i] = ip[i] | ^mask[i]
+			}
+			addrs = append(addrs, bcast)
+		}
+	}
+	return addrs
+}
+
+// parseSearchResponse reads the device out of its answer to the search. Returns nil if it is not one.
+func parseSearchResponse(msg []byte) *Device {
+	var header packet.Header
+	if err := binary.Read(bytes.NewReader(msg), binary.LittleEndian, &header); err != nil {
+		return nil
+	}
+	data := msg[20:]
+	if header.HeadFlag != 255 || header.Code != packet.IPSEARCH_RSP || int(header.DataLength) > len(data) {
+		return nil
+	}
+	data = bytes.TrimRight(data[:header.DataLength], "\x00\x0a")
+	var resp struct {
+		NetCommon map[string]interface{} `json:"NetWork.NetCommon"`
+	}
+	if err := json.Unmarshal(data, &resp); err != nil || resp.NetCommon == nil {
+		return nil
+	}
+	m := resp.NetCommon
+	str := func(key string) string {
+		s, _ := m[key].(string)
+		return s
+	}
+	num := func(key string) int {
+		switch v := m[key].(type) {
+		case float64:
+			return int(v)
+		case string:
+			n, _ := strconv.ParseInt(v, 0, 64)
+			return int(n)
+		}
+		return 0
+	}
+	d := &Device{
+		Protocol:     ProtocolDVRIP,
+		Name:         str("HostName"),
+		Model:        str("DeviceModel"),
+		MAC:          str("MAC"),
+		IP:           hexIP(str("HostIP")),
+		Mask:         hexIP(str("Submask")),
+		Gateway:      hexIP(str("GateWay")),
+		SerialNumber: str("SN"),
+		Firmware:     str("Version"),
+		Channels:     num("ChannelNum"),
+		TCPPort:      num("TCPPort"),
+		UDPPort:      num("UDPPort"),
+		HTTPPort:     num("HttpPort"),
+		SSLPort:      num("SSLPort"),
+	}
+	if d.MAC == "" || d.IP == "" {
+		return nil
+	}
+	return d
+}
+
+// hexIP converts the IPv4 address as sent by the devices, e.g. "0x0A01A8C0" for 192.168.1.10
+func hexIP(s string) string {
+	n, err := strconv.ParseUint(s, 0, 32)
+	if err != nil {
+		return ""
+	}
+	ip := make(net.IP, 4)
+	binary.LittleEndian.PutUint32(ip, uint32(n))
+	return ip.String()
+}
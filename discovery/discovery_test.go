@@ -0,0 +1,83 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// A search reply as sent by an XMeye camera
+const searchReply = `{ "NetWork.NetCommon" : { "BuildDate" : "2019-06-11 14:18:47", "ChannelNum" : 1, "DeviceType" : 1, ` +
+	`"GateWay" : "0x0101A8C0", "HostIP" : "0x0A01A8C0", "HostName" : "LocalHost", "HttpPort" : 80, ` +
+	`"MAC" : "00:12:41:8b:2a:3c", "MaxBps" : 0, "MonMode" : "TCP", "SN" : "9a6d3c8f1e2b4a5c", "SSLPort" : 8443, ` +
+	`"Submask" : "0x00FFFFFF", "TCPMaxConn" : 10, "TCPPort" : 34567, "TransferPlan" : "Quality", "UDPPort" : 34568, ` +
+	`"UseHSDownLoad" : false, "Version" : "V4.02.R11.00000531.10010.131600.00000" }, "Ret" : 100, "SessionID" : "0x00000000" }`
+
+func searchPacket(code packet.Code, data string) []byte {
+	data += "\x0a\x00"
+	header := packet.Header{HeadFlag: 255, Version: 1, Code: code, DataLength: uint32(len(data))}
+	var b bytes.Buffer
+	binary.Write(&b, binary.LittleEndian, header)
+	b.WriteString(data)
+	return b.Bytes()
+}
+
+func TestParseSearchResponse(t *testing.T) {
+	d := parseSearchResponse(searchPacket(packet.IPSEARCH_RSP, searchReply))
+	if d == nil {
+		t.Fatal("Expected a device, got nil")
+	}
+	expected := Device{
+		Protocol:     ProtocolDVRIP,
+		Name:         "LocalHost",
+		MAC:          "00:12:41:8b:2a:3c",
+		IP:           "192.168.1.10",
+		Mask:         "255.255.255.0",
+		Gateway:      "192.168.1.1",
+		SerialNumber: "9a6d3c8f1e2b4a5c",
+		Firmware:     "V4.02.R11.00000531.10010.131600.00000",
+		Channels:     1,
+		TCPPort:      34567,
+		UDPPort:      34568,
+		HTTPPort:     80,
+		SSLPort:      8443,
+	}
+	if *d != expected {
+		t.Errorf("Expected %+v, got %+v", expected, *d)
+	}
+
+	full := searchPacket(packet.IPSEARCH_RSP, searchReply)
+	invalid := map[string][]byte{
+		"wrong code":   searchPacket(packet.IPSEARCH_RSP+1, searchReply),
+		"no MAC":       searchPacket(packet.IPSEARCH_RSP, `{"NetWork.NetCommon":{"HostIP":"0x0A01A8C0"}}`),
+		"no NetCommon": searchPacket(packet.IPSEARCH_RSP, `{"Ret":100}`),
+		"not JSON":     searchPacket(packet.IPSEARCH_RSP, "hello"),
+		"truncated":    full[:len(full)-10],
+		"header only":  full[:20],
+		"short header": full[:10],
+		"wrong flag":   append([]byte{0}, full[1:]...),
+	}
+	for name, msg := range invalid {
+		if d := parseSearchResponse(msg); d != nil {
+			t.Errorf("%v: expected nil, got %+v", name, *d)
+		}
+	}
+}
+
+func TestHexIP(t *testing.T) {
+	tests := map[string]string{
+		"0x0A01A8C0":  "192.168.1.10",
+		"0x00FFFFFF":  "255.255.255.0",
+		"0xFFFFFFFF":  "255.255.255.255",
+		"0x100000000": "",
+		"":            "",
+		"bogus":       "",
+	}
+	for s, expected := range tests {
+		if ip := hexIP(s); ip != expected {
+			t.Errorf("hexIP(%q): expected %q, got %q", s, expected, ip)
+		}
+	}
+}
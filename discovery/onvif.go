@@ -0,0 +1,126 @@
+package discovery
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WS-Discovery multicast group
+var wsDiscoveryAddr = &net.UDPAddr{IP: net.IPv4(239, 255, 255, 250), Port: 3702}
+
+const wsDiscoveryProbe = `<?xml version="1.0" encoding="UTF-8"?>` +
+	`<e:Envelope xmlns:e="http://www.w3.org/2003/05/soap-envelope" xmlns:w="http://schemas.xmlsoap.org/ws/2004/08/addressing" ` +
+	`xmlns:d="http://schemas.xmlsoap.org/ws/2005/04/discovery" xmlns:dn="http://www.onvif.org/ver10/network/wsdl">` +
+	`<e:Header><w:MessageID>uuid:%MESSAGE_ID%</w:MessageID>` +
+	`<w:To e:mustUnderstand="true">urn:schemas-xmlsoap-org:ws:2005:04:discovery</w:To>` +
+	`<w:Action e:mustUnderstand="true">http://schemas.xmlsoap.org/ws/2005/04/discovery/Probe</w:Action></e:Header>` +
+	`<e:Body><d:Probe><d:Types>dn:NetworkVideoTransmitter</d:Types></d:Probe></e:Body></e:Envelope>`
+
+// DiscoverONVIF probes the LAN for ONVIF cameras (WS-Discovery), and returns the ones that answer within the timeout,
+// by IP address
+func DiscoverONVIF(ctx context.Context, timeout time.Duration) ([]*Device, error) {
+	conn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	probe := strings.Replace(wsDiscoveryProbe, "%MESSAGE_ID%", uuid.New().String(), 1)
+	if _, err = conn.WriteToUDP([]byte(probe), wsDiscoveryAddr); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetReadDeadline(deadline)
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetReadDeadline(time.Now())
+	})
+	defer stop()
+	found := map[string]*Device{}
+	buf := make([]byte, 65536)
+	for {
+		n, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				break
+			}
+			return nil, err
+		}
+		for _, d := range parseProbeMatches(buf[:n]) {
+			found[d.ONVIF] = d
+		}
+	}
+	devices := make([]*Device, 0, len(found))
+	for _, d := range found {
+		devices = append(devices, d)
+	}
+	sort.Slice(devices, func(i, j int) bool {
+		return compareIPs(devices[i].IP, devices[j].IP) < 0
+	})
+	return devices, nil
+}
+
+// parseProbeMatches reads the devices out of an answer to the probe
+func parseProbeMatches(msg []byte) []*Device {
+	var resp struct {
+		Matches []struct {
+			XAddrs string `xml:"XAddrs"`
+			Scopes string `xml:"Scopes"`
+		} `xml:"Body>ProbeMatches>ProbeMatch"`
+	}
+	if err := xml.Unmarshal(msg, &resp); err != nil {
+		return nil
+	}
+	var devices []*Device
+	for _, m := range resp.Matches {
+		d := &Device{Protocol: ProtocolONVIF}
+		// The device may be reachable at several addresses (e.g. IPv6 as well), the IPv4 one is preferred
+		for _, xaddr := range strings.Fields(m.XAddrs) {
+			u, err := url.Parse(xaddr)
+			if err != nil || u.Hostname() == "" {
+				continue
+			}
+			ip := net.ParseIP(u.Hostname())
+			if d.ONVIF == "" || (ip != nil && ip.To4() != nil && net.ParseIP(d.IP).To4() == nil) {
+				d.ONVIF = xaddr
+				d.IP = u.Hostname()
+				d.HTTPPort = 80
+				if u.Port() != "" {
+					d.HTTPPort, _ = strconv.Atoi(u.Port())
+				}
+			}
+		}
+		if d.ONVIF == "" {
+			continue
+		}
+		// e.g. onvif://www.onvif.org/name/IPC onvif://www.onvif.org/hardware/HI3518E
+		for _, scope := range strings.Fields(m.Scopes) {
+			key, value, ok := strings.Cut(strings.TrimPrefix(scope, "onvif://www.onvif.org/"), "/")
+			if !ok {
+				continue
+			}
+			value, _ = url.PathUnescape(value)
+			switch strings.ToLower(key) {
+			case "name":
+				d.Name = value
+			case "hardware":
+				d.Model = value
+			case "mac":
+				d.MAC = value
+			}
+		}
+		devices = append(devices, d)
+	}
+	return devices
+}
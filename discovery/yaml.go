@@ -0,0 +1,105 @@
+package discovery
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/greendrake/cctv/camera"
+	"github.com/greendrake/cctv/onvif"
+	"gopkg.in/yaml.v3"
+)
+
+// The DVRIP port the cameras are connected to
+const dvripPort = 34567
+
+// cameraSnippet has the fields of camera.Camera worth pre-filling
+type cameraSnippet struct {
+	Name     camera.CamName    `yaml:"Name"`
+	Type     camera.CamType    `yaml:"Type,omitempty"`
+	Address  string            `yaml:"Address"`
+	ONVIFURL string            `yaml:"ONVIFURL,omitempty"`
+	User     string            `yaml:"User"`
+	Password string            `yaml:"Password"`
+	Channel  int               `yaml:"Channel,omitempty"`
+	Save     []camera.StreamID `yaml:"Save,flow"`
+	WebCast  []camera.StreamID `yaml:"WebCast,flow"`
+}
+
+// CamerasYAML makes the camera configuration of the devices, ready to be pasted under "Cameras:" of config.yaml.
+// A multi-channel DVRIP device (NVR) makes a camera per channel.
+func CamerasYAML(devices []*Device) ([]byte, error) {
+	list := &yaml.Node{Kind: yaml.SequenceNode}
+	for _, d := range devices {
+		channels := max(d.Channels, 1)
+		for ch := 0; ch < channels; ch++ {
+			c := cameraSnippet{
+				Name:    camera.CamName("cam-" + strings.ReplaceAll(d.IP, ".", "-")),
+				Address: d.IP,
+				User:    "admin",
+				Channel: ch,
+				Save:    []camera.StreamID{camera.StreamMain},
+				WebCast: []camera.StreamID{camera.StreamExtra},
+			}
+			if d.Protocol == ProtocolONVIF {
+				c.Type = camera.CamType(ProtocolONVIF)
+				if d.ONVIF != "http://"+d.IP+onvif.DefaultPath {
+					c.ONVIFURL = d.ONVIF
+				}
+			}
+			if channels > 1 {
+				c.Name += camera.CamName(fmt.Sprintf("-ch%d", ch))
+			}
+			item := &yaml.Node{}
+			if err := item.Encode(c); err != nil {
+				return nil, err
+			}
+			if ch == 0 {
+				item.HeadComment = d.String()
+				if d.TCPPort != 0 && d.TCPPort != dvripPort {
+					item.HeadComment += fmt.Sprintf("\nDVRIP port %v is not the default %v, which is the only one supported", d.TCPPort, dvripPort)
+				}
+			}
+			list.Content = append(list.Content, item)
+		}
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(list); err != nil {
+		return nil, err
+	}
+	enc.Close()
+	// Indented as the items of the Cameras list
+	var out bytes.Buffer
+	for _, line := range strings.SplitAfter(buf.String(), "\n") {
+		if line != "" {
+			out.WriteString("  " + line)
+		}
+	}
+	return out.Bytes(), nil
+}
+
+func (d *Device) String() string {
+	s := d.Protocol + " " + d.Name
+	if d.Model != "" {
+		s += " (" + d.Model + ")"
+	}
+	s += ", IP " + d.IP
+	if d.MAC != "" {
+		s += ", MAC " + d.MAC
+	}
+	if d.SerialNumber != "" {
+		s += ", serial number " + d.SerialNumber
+	}
+	if d.Firmware != "" {
+		s += ", firmware " + d.Firmware
+	}
+	if d.Channels > 1 {
+		s += fmt.Sprintf(", %v channels", d.Channels)
+	}
+	if d.TCPPort != 0 {
+		s += fmt.Sprintf(", media (TCP) port %v", d.TCPPort)
+	}
+	return s + fmt.Sprintf(", web port %v", d.HTTPPort)
+}
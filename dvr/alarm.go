@@ -0,0 +1,109 @@
+package dvrip
+
+import (
+	"context"
+	"fmt"
+	"github.com/greendrake/cctv/dvr/packet"
+	"github.com/greendrake/cctv/event"
+	"log"
+	"time"
+)
+
+// Alarm is pushed by the device to the connections subscribed with AlarmStart
+type Alarm struct {
+	Channel int
+	// As named by the device, e.g. "VideoMotion"
+	Event string
+	Start bool
+	// By the device clock. Zero if the device did not tell.
+	Time time.Time
+}
+
+// Alarm events as named by the devices
+var alarmTypes = map[string]event.Type{
+	"VideoMotion":              event.Motion,
+	"VideoLoss":                event.VideoLoss,
+	"VideoBlind":               event.Blind,
+	"HumanDetect":              event.Human,
+	"appEventHumanDetectAlarm": event.Human,
+	"LocalAlarm":               event.Input,
+}
+
+// Type maps the alarm onto the generic event types
+func (a *Alarm) Type() event.Type {
+	if t, ok := alarmTypes[a.Event]; ok {
+		return t
+	}
+	return event.Other
+}
+
+// AlarmStart subscribes the connection to the alarms of all channels of the device
+func (c *Client) AlarmStart() error {
+	// The request carries no command name
+	resp, err := c.Request(packet.ALARM_SET_REQ, nil)
+	if err != nil {
+		return err
+	}
+	return checkStatus(resp.Data)
+}
+
+// WatchAlarms subscribes a connection of its own within the session to the alarms of all channels of the device,
+// and calls fn with each of them until the context is done (returning nil) or the connection fails.
+// Zone-less alarm times are taken as being in loc.
+func (s *Session) WatchAlarms(ctx context.Context, loc *time.Location, fn func(a *Alarm)) error {
+	client, _, err := s.mediaClient(ctx, func(c *Client, joined bool) error {
+		return c.AlarmStart()
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Disconnect()
+	for ctx.Err() == nil {
+		client.MaybePingKeepAlive()
+		m, err := client.GetMessage()
+		if notYet(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if m.Code != packet.ALARM_INFO && m.Code != packet.NET_ALARM {
+			continue
+		}
+		a, err := parseAlarm(m.Data, loc)
+		if err != nil {
+			log.Printf("Cannot parse alarm from DVRIP device %v: %v", s.address, err)
+			continue
+		}
+		fn(a)
+	}
+	return nil
+}
+
+// parseAlarm parses an alarm message. Its zone-less time is taken as being in loc.
+func parseAlarm(data []byte, loc *time.Location) (*Alarm, error) {
+	m, err := parseResponse(data)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := m["Name"].(string)
+	info, ok := m[name].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("No alarm info in %s", data)
+	}
+	a := &Alarm{}
+	a.Event, _ = info["Event"].(string)
+	if a.Event == "" {
+		return nil, fmt.Errorf("No alarm event in %s", data)
+	}
+	channel, _ := info["Channel"].(float64)
+	a.Channel = int(channel)
+	status, _ := info["Status"].(string)
+	a.Start = status == "Start"
+	if startTime, ok := info["StartTime"].(string); ok {
+		if t, err := time.ParseInLocation(time.DateTime, startTime, loc); err == nil {
+			a.Time = t
+		}
+	}
+	return a, nil
+}
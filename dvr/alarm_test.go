@@ -0,0 +1,63 @@
+package dvrip
+
+import (
+	"testing"
+	"time"
+
+	"github.com/greendrake/cctv/event"
+)
+
+func TestParseAlarm(t *testing.T) {
+	nz, err := time.LoadLocation("Pacific/Auckland")
+	if err != nil {
+		t.Skip(err)
+	}
+	tests := []struct {
+		name string
+		data string
+		// nil if the payload must be rejected
+		alarm *Alarm
+		t     event.Type
+	}{
+		{
+			"motion start",
+			"{ \"AlarmInfo\" : { \"Channel\" : 0, \"Event\" : \"VideoMotion\", \"StartTime\" : \"2024-05-01 12:03:04\", \"Status\" : \"Start\" }, \"Name\" : \"AlarmInfo\", \"SessionID\" : \"0x00000002\" }\n\x00",
+			&Alarm{Channel: 0, Event: "VideoMotion", Start: true, Time: time.Date(2024, 5, 1, 12, 3, 4, 0, nz)},
+			event.Motion,
+		},
+		{
+			"human stop on channel 3",
+			`{"Name":"AlarmInfo","AlarmInfo":{"Channel":3,"Event":"appEventHumanDetectAlarm","StartTime":"2024-05-01 12:05:00","Status":"Stop"},"SessionID":"0x0000000b"}`,
+			&Alarm{Channel: 3, Event: "appEventHumanDetectAlarm", Time: time.Date(2024, 5, 1, 12, 5, 0, 0, nz)},
+			event.Human,
+		},
+		{
+			"unknown event without time",
+			`{"Name":"AlarmInfo","AlarmInfo":{"Channel":1,"Event":"StorageFailure","Status":"Start"},"SessionID":"0x00000002"}`,
+			&Alarm{Channel: 1, Event: "StorageFailure", Start: true},
+			event.Other,
+		},
+		{"no info", `{"Name":"AlarmInfo","SessionID":"0x00000002"}`, nil, ""},
+		{"no event", `{"Name":"AlarmInfo","AlarmInfo":{"Channel":0,"Status":"Start"}}`, nil, ""},
+		{"not JSON", "AlarmInfo\x00", nil, ""},
+	}
+	for _, test := range tests {
+		a, err := parseAlarm([]byte(test.data), nz)
+		if test.alarm == nil {
+			if err == nil {
+				t.Errorf("%v: expected an error, got %+v", test.name, a)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%v: expected %+v, got %v", test.name, test.alarm, err)
+			continue
+		}
+		if a.Channel != test.alarm.Channel || a.Event != test.alarm.Event || a.Start != test.alarm.Start || !a.Time.Equal(test.alarm.Time) {
+			t.Errorf("%v: expected %+v, got %+v", test.name, test.alarm, a)
+		}
+		if a.Type() != test.t {
+			t.Errorf("%v: expected type %v, got %v", test.name, test.t, a.Type())
+		}
+	}
+}
@@ -91,6 +91,8 @@ type Client struct {
 	keepAliveInterval uint8
 	lastKeepAlivePing int64
 	Ctx               context.Context
+	// Stops closing the connection with the end of the session it is a media connection of
+	unwatch func() bool
 }
 
 var TimeoutError = errors.New("Network timeout")
@@ -104,23 +106,32 @@ func NewClient(ctx context.Context, address string, args ...string) (*Client, er
 	if len(args) > 1 && len(args[1]) > 0 {
 		password = args[1]
 	}
-	address = address + ":" + portTCP
 	client := &Client{
 		settings: &Settings{
-			Address:      address,
+			Address:      address + ":" + portTCP,
 			User:         user,
 			PasswordHash: sofiaHash(password),
 		},
 		Ctx:               ctx,
 		lastKeepAlivePing: time.Now().Unix(),
 	}
-	var (
-		err    error
-		dialer net.Dialer
-	)
+	var err error
+	if client.c, err = dial(ctx, client.settings.Address); err != nil {
+		return nil, err
+	}
+	err = client.Login()
+	if err != nil {
+		client.Disconnect()
+		return nil, err
+	}
+	return client, nil
+}
+
+func dial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
 	dialCtx, cancel := context.WithTimeout(ctx, DialTimout)
 	defer cancel()
-	client.c, err = dialer.DialContext(dialCtx, "tcp", address)
+	conn, err := dialer.DialContext(dialCtx, "tcp", address)
 	if err != nil {
 		if strings.Contains(err.Error(), "connection refused") {
 			// Wait DialTimout because the dialer doesn't (it tries to re-connect a few times per second)
@@ -128,14 +139,15 @@ func NewClient(ctx context.Context, address string, args ...string) (*Client, er
 		}
 		return nil, err
 	}
-	err = client.Login()
-	if err != nil {
-		return nil, err
-	}
-	return client, nil
+	return conn, nil
 }
 
 func (c *Client) send(msgID packet.Code, data []byte) error {
+	return c.sendRaw(msgID, append(data, magicEnd...))
+}
+
+// sendRaw sends the data as is, e.g. media which, unlike commands, is not terminated with magicEnd
+func (c *Client) sendRaw(msgID packet.Code, data []byte) error {
 	var buf bytes.Buffer
 	if err := binary.Write(&buf, binary.LittleEndian, packet.Header{
 		HeadFlag:       255,
@@ -143,16 +155,13 @@ func (c *Client) send(msgID packet.Code, data []byte) error {
 		SessionId:      c.session,
 		SequenceNumber: c.packetSequence,
 		Code:           msgID,
-		DataLength:     uint32(len(data)) + 2,
+		DataLength:     uint32(len(data)),
 	}); err != nil {
 		return err
 	}
-	err := binary.Write(&buf, binary.LittleEndian, append(data, magicEnd...))
-	if err != nil {
-		return err
-	}
+	buf.Write(data)
 	c.c.SetWriteDeadline(time.Now().Add(WriteTimeout))
-	_, err = c.c.Write(buf.Bytes())
+	_, err := c.c.Write(buf.Bytes())
 	if err != nil {
 		return err
 	}
@@ -263,13 +272,7 @@ func (c *Client) Login() error {
 	if responsePacket.Header.Code != packet.LOGIN_RSP {
 		return fmt.Errorf("Unexepcted response code to login request: %d", responsePacket.Header.Code)
 	}
-	resp := responsePacket.Data
-	// Avoid "invalid character '\x00' after top-level value" error
-	if len(resp) > 2 && bytes.Compare(resp[len(resp)-2:], []byte{10, 0}) == 0 {
-		resp = resp[:len(resp)-2]
-	}
-	m := map[string]interface{}{}
-	err = json.Unmarshal(resp, &m)
+	m, err := parseResponse(responsePacket.Data)
 	if err != nil {
 		return err
 	}
@@ -293,6 +296,43 @@ func (c *Client) Login() error {
 	return nil
 }
 
+func parseResponse(resp []byte) (map[string]interface{}, error) {
+	// Avoid "invalid character '\x00' after top-level value" error
+	if len(resp) > 2 && bytes.Compare(resp[len(resp)-2:], []byte{10, 0}) == 0 {
+		resp = resp[:len(resp)-2]
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal(resp, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// StatusError is a response to a command reporting a failure
+type StatusError struct {
+	Status statusCode
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("status code %d - %v", e.Status, statusCodes[e.Status])
+}
+
+// checkStatus returns StatusError if the response does not report success
+func checkStatus(resp []byte) error {
+	m, err := parseResponse(resp)
+	if err != nil {
+		return err
+	}
+	status, ok := m["Ret"].(float64)
+	if !ok {
+		return fmt.Errorf("ret is not an int: %v", m["Ret"])
+	}
+	if sc := statusCode(status); sc != statusOK && sc != statusUpgradeSuccessful {
+		return &StatusError{sc}
+	}
+	return nil
+}
+
 func (c *Client) makeCommand(command packet.Code, data interface{}) ([]byte, error) {
 	m := map[string]interface{}{
 		"Name":      packet.Commands[command],
@@ -317,8 +357,53 @@ func (c *Client) Command(command packet.Code, data interface{}, getMessage bool)
 	return err
 }
 
-func (c *Client) SetTime() error {
-	return c.Command(packet.SYSMANAGER_REQ, time.Now().UTC().Format("2006-01-02 15:04:05"), true)
+// Request sends the command and returns the response to it, i.e. the next message with the following code
+func (c *Client) Request(command packet.Code, data interface{}) (*message.Message, error) {
+	params, err := c.makeCommand(command, data)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.send(command, params); err != nil {
+		return nil, err
+	}
+	for {
+		m, err := c.GetMessage()
+		if err != nil {
+			return nil, err
+		}
+		if m.Code == command+1 {
+			return m, nil
+		}
+	}
+}
+
+// SetTime sets the device clock to the time as in its location, which should be the time zone the device clock is in
+func (c *Client) SetTime(t time.Time) error {
+	resp, err := c.Request(packet.SYSMANAGER_REQ, t.Format(time.DateTime))
+	if err != nil {
+		return err
+	}
+	return checkStatus(resp.Data)
+}
+
+// GetTime returns the time of the device clock, which is zone-less and so is taken as being in loc
+func (c *Client) GetTime(loc *time.Location) (time.Time, error) {
+	resp, err := c.Request(packet.TIMEQUERY_REQ, nil)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if err = checkStatus(resp.Data); err != nil {
+		return time.Time{}, err
+	}
+	m, err := parseResponse(resp.Data)
+	if err != nil {
+		return time.Time{}, err
+	}
+	s, ok := m[packet.Commands[packet.TIMEQUERY_REQ]].(string)
+	if !ok {
+		return time.Time{}, fmt.Errorf("No time in %s", resp.Data)
+	}
+	return time.ParseInLocation(time.DateTime, s, loc)
 }
 
 func (c *Client) Logout() error {
@@ -326,6 +411,9 @@ func (c *Client) Logout() error {
 }
 
 func (c *Client) Disconnect() error {
+	if c.unwatch != nil {
+		c.unwatch()
+	}
 	return c.c.Close()
 }
 
@@ -341,32 +429,47 @@ func (c *Client) MaybePingKeepAlive() error {
 	return err
 }
 
-func (c *Client) Monitor(stream string) error {
-	err := c.Command(packet.MONITOR_CLAIM, map[string]interface{}{
+// Monitor starts streaming of the channel's stream ("Main" or "Extra") over this connection
+func (c *Client) Monitor(channel int, stream string) error {
+	params, err := c.makeCommand(packet.MONITOR_CLAIM, map[string]interface{}{
 		"Action": "Claim",
 		"Parameter": map[string]interface{}{
-			"Channel":    0,
+			"Channel":    channel,
 			"CombinMode": "NONE",
 			"StreamType": stream,
 			"TransMode":  "TCP",
 		},
-	}, true)
+	})
 	if err != nil {
 		return err
 	}
-	// TODO: check resp
+	if err = c.send(packet.MONITOR_CLAIM, params); err != nil {
+		return err
+	}
+	resp, err := c.GetMessage()
+	if err != nil {
+		return err
+	}
+	if resp.Code == packet.MONITOR_CLAIM_RSP {
+		if err = checkStatus(resp.Data); err != nil {
+			return err
+		}
+	}
 	data, err := json.Marshal(map[string]interface{}{
 		"Name":      "OPMonitor",
 		"SessionID": fmt.Sprintf("%08X", c.session),
 		"OPMonitor": map[string]interface{}{
 			"Action": "Start",
 			"Parameter": map[string]interface{}{
-				"Channel":    0,
+				"Channel":    channel,
 				"CombinMode": "NONE",
 				"StreamType": stream,
 				"TransMode":  "TCP",
 			},
 		},
 	})
+	if err != nil {
+		return err
+	}
 	return c.send(1410, data)
 }
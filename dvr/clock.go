@@ -0,0 +1,82 @@
+package dvrip
+
+import (
+	"log"
+	"time"
+)
+
+const (
+	defaultMaxClockDrift = 5 * time.Second
+	// How often to remind about the clocks still being out of sync
+	driftLogInterval = time.Hour
+)
+
+// Clock follows the camera's own clock. Key frames carry the camera's wall-clock time (as shown on its overlay)
+// with second precision; in between, the time is advanced by frame durations.
+// It also watches how far the camera clock is from the host one, and logs when they diverge.
+type Clock struct {
+	Name     string         // For logging
+	Location *time.Location // Time zone of the camera's clock. The host's one by default
+	MaxDrift time.Duration  // Log when the camera and host clocks diverge more than this. 5s by default
+	// Whether to time-stamp frames with the camera clock at all (otherwise only watch the drift)
+	Stamp bool
+	// The footage was recorded earlier (e.g. on the device), so its time is not to be compared with the host clock
+	Past bool
+
+	now      time.Time // Camera time of the next video frame
+	offset   time.Duration
+	diverged bool
+	lastLog  time.Time
+}
+
+// keyFrame syncs the clock with the camera time of a key frame, which is given as a zone-less date/time
+func (c *Clock) keyFrame(dateTime time.Time) time.Time {
+	loc := c.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	camTime := time.Date(dateTime.Year(), dateTime.Month(), dateTime.Day(), dateTime.Hour(), dateTime.Minute(), dateTime.Second(), 0, loc)
+	if !c.Past {
+		c.checkDrift(camTime, time.Now())
+	}
+	// The key frame was taken within the second given, so keep the interpolated time if it fits in there
+	switch {
+	case c.now.IsZero() || c.now.Before(camTime.Add(-time.Second)) || c.now.After(camTime.Add(2*time.Second)):
+		// First frame, or the camera clock has been changed
+		c.now = camTime
+	case c.now.Before(camTime):
+		c.now = camTime
+	case !c.now.Before(camTime.Add(time.Second)):
+		c.now = camTime.Add(time.Second - time.Millisecond)
+	}
+	return c.now
+}
+
+// next returns the camera time of the video frame and advances the clock by its duration
+func (c *Clock) next(duration time.Duration) time.Time {
+	t := c.now
+	c.now = c.now.Add(duration)
+	return t
+}
+
+// Offset returns how much the camera clock is ahead of the host one (negative if behind), as of the last key frame
+func (c *Clock) Offset() time.Duration {
+	return c.offset
+}
+
+func (c *Clock) checkDrift(camTime time.Time, hostTime time.Time) {
+	maxDrift := c.MaxDrift
+	if maxDrift <= 0 {
+		maxDrift = defaultMaxClockDrift
+	}
+	// The camera time is truncated to seconds, so compare against the middle of that second
+	c.offset = camTime.Add(500 * time.Millisecond).Sub(hostTime).Round(time.Second)
+	diverged := c.offset > maxDrift || c.offset < -maxDrift
+	if diverged && (!c.diverged || time.Since(c.lastLog) >= driftLogInterval) {
+		log.Printf("%v clock is off the host clock by %v (camera: %v, host: %v)", c.Name, c.offset, camTime.Format(time.DateTime), hostTime.In(camTime.Location()).Format(time.DateTime))
+		c.lastLog = time.Now()
+	} else if !diverged && c.diverged {
+		log.Printf("%v clock is back in sync with the host clock (off by %v)", c.Name, c.offset)
+	}
+	c.diverged = diverged
+}
@@ -0,0 +1,179 @@
+package dvrip
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/greendrake/cctv/dvr/frame"
+	"github.com/greendrake/cctv/dvr/packet"
+	gframe "github.com/greendrake/cctv/frame"
+)
+
+// How long the device may go silent before the download is deemed finished
+const downloadIdleTimeout = 10 * time.Second
+
+// Download streams a file recorded on the device, as fast as the device sends it
+type Download struct {
+	converter
+	client   *Client
+	session  *Session
+	params   map[string]interface{}
+	lastData time.Time
+	ended    bool
+	// Received data not yet split into frames
+	buf []byte
+}
+
+// Download starts downloading the file of the channel within the session. The frames are time-stamped by the clock
+// (which should be Past). The session is released on Close().
+func (s *Session) Download(ctx context.Context, channel int, file *RecordFile, clock *Clock) (*Download, error) {
+	params := map[string]interface{}{
+		"Action":    "Claim",
+		"StartTime": file.Begin.Format(time.DateTime),
+		"EndTime":   file.End.Format(time.DateTime),
+		"Parameter": map[string]interface{}{
+			"Channel":    channel,
+			"FileName":   file.Name,
+			"PlayMode":   "ByName",
+			"StreamType": 0,
+			"TransMode":  "TCP",
+			"Value":      0,
+		},
+	}
+	client, _, err := s.mediaClient(ctx, func(c *Client, joined bool) error {
+		return c.startDownload(params)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Download{
+		converter: converter{Clock: clock},
+		client:    client,
+		session:   s,
+		params:    params,
+		lastData:  time.Now(),
+	}, nil
+}
+
+func (c *Client) startDownload(params map[string]interface{}) error {
+	params["Action"] = "Claim"
+	resp, err := c.Request(packet.PLAYBACK_CLAIM, params)
+	if err != nil {
+		return err
+	}
+	if err = checkStatus(resp.Data); err != nil {
+		return err
+	}
+	params["Action"] = "DownloadStart"
+	return c.Command(packet.PLAYBACK_REQ, params, false)
+}
+
+// AudioFormat is always G.711 A-law, 8 kHz mono, with DVRIP
+func (d *Download) AudioFormat() *gframe.AudioFormat {
+	return audioFormat()
+}
+
+// GetFrame returns the next frame of the file, or io.EOF at its end
+func (d *Download) GetFrame() (*gframe.Frame, error) {
+	for {
+		if msg := d.nextRawFrame(); msg != nil {
+			raw, err := parseRawFrame(msg)
+			if err != nil {
+				return nil, err
+			}
+			return d.convert(raw)
+		}
+		if d.ended {
+			return nil, io.EOF
+		}
+		if err := d.receive(); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// receive reads the next portion of the file into the buffer
+func (d *Download) receive() error {
+	d.client.MaybePingKeepAlive()
+	m, err := d.client.GetMessage()
+	if err != nil {
+		if notYet(err) {
+			if time.Since(d.lastData) < downloadIdleTimeout {
+				return nil
+			}
+			err = io.EOF
+		}
+		if errors.Is(err, io.EOF) {
+			d.ended = true
+			return nil
+		}
+		return err
+	}
+	d.lastData = time.Now()
+	switch m.Code {
+	case packet.PLAYBACK_DATA:
+		if len(m.Data) == 0 {
+			// End of the file
+			d.ended = true
+		}
+		d.buf = append(d.buf, m.Data...)
+	case packet.PLAYBACK_RSP:
+		return checkStatus(m.Data)
+	}
+	// Anything else (e.g. keep-alive responses) is ignored
+	return nil
+}
+
+// nextRawFrame cuts the next whole frame off the buffer, if it has one. Unlike monitoring, the file is sent
+// in packets regardless of where its frames start and end, so they have to be found in it.
+func (d *Download) nextRawFrame() []byte {
+	for len(d.buf) >= 4 {
+		_, known := frame.TMap[frame.Type(d.buf[3])]
+		if d.buf[0] != 0x00 || d.buf[1] != 0x00 || d.buf[2] != 0x01 || !known {
+			// Skip to the next frame start
+			i := bytes.Index(d.buf[1:], []byte{0x00, 0x00, 0x01})
+			if i < 0 {
+				d.buf = d.buf[len(d.buf)-2:]
+				return nil
+			}
+			d.buf = d.buf[i+1:]
+			continue
+		}
+		header := frame.TMap[frame.Type(d.buf[3])]()
+		ownLength := int(header.GetOwnLength())
+		if len(d.buf) < ownLength {
+			return nil
+		}
+		if err := binary.Read(bytes.NewReader(d.buf[4:ownLength]), binary.LittleEndian, header); err != nil {
+			return nil
+		}
+		length := ownLength + int(header.GetLength())
+		if len(d.buf) < length {
+			return nil
+		}
+		msg := d.buf[:length]
+		d.buf = d.buf[length:]
+		return msg
+	}
+	return nil
+}
+
+// Close stops the download and releases the session
+func (d *Download) Close() {
+	if d.client != nil {
+		if !d.ended {
+			d.params["Action"] = "DownloadStop"
+			d.client.Command(packet.PLAYBACK_REQ, d.params, false)
+		}
+		d.client.Disconnect()
+		d.client = nil
+	}
+	if d.session != nil {
+		d.session.Release()
+		d.session = nil
+	}
+}
@@ -0,0 +1,95 @@
+package dvrip
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// The device returns this many files at most per query
+const fileQueryPage = 64
+
+// RecordFile is a recording stored on the device (e.g. on its SD card)
+type RecordFile struct {
+	Name  string
+	Begin time.Time
+	End   time.Time
+	Size  int64
+}
+
+// FileQuery lists the video files of the channel recorded on the device within the time range.
+// The device clock is zone-less, so the times are given and returned in the time zone of "from".
+func (c *Client) FileQuery(channel int, from time.Time, to time.Time) ([]*RecordFile, error) {
+	loc := from.Location()
+	to = to.In(loc)
+	var files []*RecordFile
+	// A page starts at the end of the last file of the one before, so the device lists that file (or more) again
+	seen := map[string]bool{}
+	for {
+		resp, err := c.Request(packet.FILEQUERY_REQ, map[string]interface{}{
+			"BeginTime":      from.Format(time.DateTime),
+			"EndTime":        to.Format(time.DateTime),
+			"Channel":        channel,
+			"DriverTypeMask": "0x0000FFFF",
+			"Event":          "*",
+			"StreamType":     "0x00000000",
+			"Type":           "h264",
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = checkStatus(resp.Data); err != nil {
+			return nil, err
+		}
+		m, err := parseResponse(resp.Data)
+		if err != nil {
+			return nil, err
+		}
+		// Missing if there are no files
+		list, _ := m[packet.Commands[packet.FILEQUERY_REQ]].([]interface{})
+		for _, item := range list {
+			if f := parseRecordFile(item, loc); f != nil && !seen[f.Name] {
+				seen[f.Name] = true
+				files = append(files, f)
+			}
+		}
+		if len(list) < fileQueryPage || len(files) == 0 {
+			return files, nil
+		}
+		// Next page
+		next := files[len(files)-1].End
+		if !next.After(from) {
+			return files, nil
+		}
+		from = next
+	}
+}
+
+func parseRecordFile(item interface{}, loc *time.Location) *RecordFile {
+	m, ok := item.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	f := &RecordFile{}
+	f.Name, _ = m["FileName"].(string)
+	begin, _ := m["BeginTime"].(string)
+	end, _ := m["EndTime"].(string)
+	var err error
+	if f.Begin, err = time.ParseInLocation(time.DateTime, begin, loc); err != nil {
+		return nil
+	}
+	if f.End, err = time.ParseInLocation(time.DateTime, end, loc); err != nil {
+		return nil
+	}
+	// In KB, as hex
+	if length, ok := m["FileLength"].(string); ok {
+		if kb, err := strconv.ParseInt(length, 0, 64); err == nil {
+			f.Size = kb * 1024
+		}
+	}
+	if f.Name == "" {
+		return nil
+	}
+	return f
+}
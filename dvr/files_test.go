@@ -0,0 +1,90 @@
+package dvrip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// serveFileQuery answers the file queries like a device does: with the first page of the files overlapping the
+// time range, its ends included. The files are 1MB each.
+func serveFileQuery(conn net.Conn, files []*RecordFile) {
+	defer conn.Close()
+	for {
+		var header packet.Header
+		if err := binary.Read(conn, binary.LittleEndian, &header); err != nil {
+			return
+		}
+		data := make([]byte, header.DataLength)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		var req struct {
+			OPFileQuery struct{ BeginTime, EndTime string }
+		}
+		json.Unmarshal(bytes.TrimRight(data, "\n\x00"), &req)
+		from, _ := time.ParseInLocation(time.DateTime, req.OPFileQuery.BeginTime, time.UTC)
+		to, _ := time.ParseInLocation(time.DateTime, req.OPFileQuery.EndTime, time.UTC)
+		var list []map[string]string
+		for _, f := range files {
+			if !f.End.Before(from) && !f.Begin.After(to) && len(list) < fileQueryPage {
+				list = append(list, map[string]string{
+					"FileName":   f.Name,
+					"BeginTime":  f.Begin.Format(time.DateTime),
+					"EndTime":    f.End.Format(time.DateTime),
+					"FileLength": "0x00000400",
+				})
+			}
+		}
+		resp, _ := json.Marshal(map[string]interface{}{"Name": "OPFileQuery", "Ret": 100, "OPFileQuery": list})
+		resp = append(resp, magicEnd...)
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.LittleEndian, packet.Header{
+			HeadFlag:   255,
+			Code:       packet.FILEQUERY_REQ + 1,
+			DataLength: uint32(len(resp)),
+		})
+		buf.Write(resp)
+		if _, err := conn.Write(buf.Bytes()); err != nil {
+			return
+		}
+	}
+}
+
+func TestFileQuery(t *testing.T) {
+	t0 := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	// Back to back, so that each ends when the next begins
+	var files []*RecordFile
+	for i := 0; i < 150; i++ {
+		files = append(files, &RecordFile{
+			Name:  fmt.Sprintf("/idea0/2024-05-01/001/%03d.h264", i),
+			Begin: t0.Add(time.Duration(i) * time.Minute),
+			End:   t0.Add(time.Duration(i+1) * time.Minute),
+			Size:  1 << 20,
+		})
+	}
+	client, device := net.Pipe()
+	go serveFileQuery(device, files)
+	c := &Client{c: client}
+	defer client.Close()
+
+	got, err := c.FileQuery(0, t0, t0.Add(24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(files) {
+		t.Fatalf("Expected %v files, got %v", len(files), len(got))
+	}
+	for i, f := range got {
+		if f.Name != files[i].Name || !f.Begin.Equal(files[i].Begin) || !f.End.Equal(files[i].End) || f.Size != files[i].Size {
+			t.Errorf("File %v: expected %+v, got %+v", i, files[i], f)
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package dvrip
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// SystemInfo describes the device
+type SystemInfo struct {
+	Model     string `json:"model"`
+	SerialNo  string `json:"serialNo"`
+	Firmware  string `json:"firmware"`
+	Hardware  string `json:"hardware"`
+	BuildTime string `json:"buildTime"`
+	// Analog (local) video inputs, and digital (IP) channels of an NVR
+	VideoInChannels int `json:"videoInChannels"`
+	DigitalChannels int `json:"digitalChannels"`
+	ExtraChannels   int `json:"extraChannels"`
+	AudioInChannels int `json:"audioInChannels"`
+	AlarmInputs     int `json:"alarmInputs"`
+}
+
+// Channels returns the number of video channels of the device
+func (i *SystemInfo) Channels() int {
+	return i.VideoInChannels + i.DigitalChannels
+}
+
+// Capabilities are what the device supports, as reported by SystemFunction
+type Capabilities struct {
+	// Stream types: Main, and Extra if the device encodes two streams
+	Streams []string `json:"streams"`
+	// Video codecs: H264 (assumed always), and H265 if any encode function mentions it
+	Codecs []string `json:"codecs"`
+	// All the functions reported, by group (e.g. EncodeFunction, AlarmFunction), as is
+	Functions map[string]map[string]bool `json:"functions"`
+}
+
+// SupportsStream tells whether the device has the stream type ("Main" or "Extra").
+// known is false if the device does not tell, as some leave out the DoubleStream flag Extra is told by.
+func (c *Capabilities) SupportsStream(stream string) (supported bool, known bool) {
+	if stream == "Extra" {
+		supported, known = c.Functions["EncodeFunction"]["DoubleStream"]
+		return
+	}
+	return slices.Contains(c.Streams, stream), true
+}
+
+// DeviceInfo is what the device tells about itself
+type DeviceInfo struct {
+	System       *SystemInfo   `json:"system"`
+	Capabilities *Capabilities `json:"capabilities"`
+}
+
+// query sends the command with no parameters and unmarshals its part of the response (named after it) into v
+func (c *Client) query(command packet.Code, v interface{}) error {
+	resp, err := c.Request(command, nil)
+	if err != nil {
+		return err
+	}
+	if err = checkStatus(resp.Data); err != nil {
+		return err
+	}
+	m, err := parseResponse(resp.Data)
+	if err != nil {
+		return err
+	}
+	part, ok := m[packet.Commands[command]]
+	if !ok {
+		return fmt.Errorf("No %v in %s", packet.Commands[command], resp.Data)
+	}
+	// Round trip to get the part typed
+	data, err := json.Marshal(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (c *Client) SystemInfo() (*SystemInfo, error) {
+	var raw struct {
+		DeviceModel     string
+		SerialNo        string
+		SoftWareVersion string
+		HardWare        string
+		BuildTime       string
+		VideoInChannel  int
+		DigChannel      int
+		ExtraChannel    int
+		AudioInChannel  int
+		AlarmInChannel  int
+	}
+	if err := c.query(packet.SYSINFO_REQ, &raw); err != nil {
+		return nil, err
+	}
+	return &SystemInfo{
+		Model:           raw.DeviceModel,
+		SerialNo:        raw.SerialNo,
+		Firmware:        raw.SoftWareVersion,
+		Hardware:        raw.HardWare,
+		BuildTime:       raw.BuildTime,
+		VideoInChannels: raw.VideoInChannel,
+		DigitalChannels: raw.DigChannel,
+		ExtraChannels:   raw.ExtraChannel,
+		AudioInChannels: raw.AudioInChannel,
+		AlarmInputs:     raw.AlarmInChannel,
+	}, nil
+}
+
+func (c *Client) Capabilities() (*Capabilities, error) {
+	// Groups of flags, though some devices report a few non-boolean values, which are skipped
+	var raw map[string]interface{}
+	if err := c.query(packet.ABILITY_REQ, &raw); err != nil {
+		return nil, err
+	}
+	return parseCapabilities(raw), nil
+}
+
+func parseCapabilities(raw map[string]interface{}) *Capabilities {
+	caps := &Capabilities{
+		Streams:   []string{"Main"},
+		Codecs:    []string{"H264"},
+		Functions: map[string]map[string]bool{},
+	}
+	for group, v := range raw {
+		flags, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		caps.Functions[group] = map[string]bool{}
+		for name, v := range flags {
+			if b, ok := v.(bool); ok {
+				caps.Functions[group][name] = b
+			}
+		}
+	}
+	encode := caps.Functions["EncodeFunction"]
+	if encode["DoubleStream"] {
+		caps.Streams = append(caps.Streams, "Extra")
+	}
+	for name, on := range encode {
+		if on && strings.Contains(name, "H265") {
+			caps.Codecs = append(caps.Codecs, "H265")
+			break
+		}
+	}
+	return caps
+}
+
+// DeviceInfo queries both the system info and the capabilities
+func (c *Client) DeviceInfo() (*DeviceInfo, error) {
+	system, err := c.SystemInfo()
+	if err != nil {
+		return nil, err
+	}
+	caps, err := c.Capabilities()
+	if err != nil {
+		return nil, err
+	}
+	return &DeviceInfo{
+		System:       system,
+		Capabilities: caps,
+	}, nil
+}
@@ -0,0 +1,47 @@
+package dvrip
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestParseCapabilities(t *testing.T) {
+	tests := []struct {
+		name       string
+		encode     string
+		streams    []string
+		codecs     []string
+		extra      bool
+		extraKnown bool
+	}{
+		{"two streams", `{"DoubleStream":true,"SmartH264":true,"SmartH265":true,"WaterMark":false}`, []string{"Main", "Extra"}, []string{"H264", "H265"}, true, true},
+		{"one stream", `{"DoubleStream":false,"SmartH264":true,"SmartH265":false}`, []string{"Main"}, []string{"H264"}, false, true},
+		{"no flag", `{"SmartH264":true}`, []string{"Main"}, []string{"H264"}, false, false},
+	}
+	for _, test := range tests {
+		// The SystemFunction part of the reply
+		reply := `{"AlarmFunction":{"MotionDetect":true,"BlindDetect":true},"EncodeFunction":` + test.encode +
+			`,"OtherFunction":{"SupportPTZTour":false},"MaxPreRecord":4}`
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(reply), &raw); err != nil {
+			t.Fatal(err)
+		}
+		caps := parseCapabilities(raw)
+		if !slices.Equal(caps.Streams, test.streams) {
+			t.Errorf("%v: expected streams %v, got %v", test.name, test.streams, caps.Streams)
+		}
+		if !slices.Equal(caps.Codecs, test.codecs) {
+			t.Errorf("%v: expected codecs %v, got %v", test.name, test.codecs, caps.Codecs)
+		}
+		if !caps.Functions["AlarmFunction"]["MotionDetect"] {
+			t.Errorf("%v: expected AlarmFunction.MotionDetect", test.name)
+		}
+		if supported, known := caps.SupportsStream("Main"); !supported || !known {
+			t.Errorf("%v: expected Main supported and known, got %v, %v", test.name, supported, known)
+		}
+		if supported, known := caps.SupportsStream("Extra"); supported != test.extra || known != test.extraKnown {
+			t.Errorf("%v: expected Extra %v, %v, got %v, %v", test.name, test.extra, test.extraKnown, supported, known)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/greendrake/cctv/dvr/frame"
 	"github.com/greendrake/cctv/dvr/packet"
@@ -17,29 +18,41 @@ import (
 
 type Monitor struct {
 	eventbus.EventBus
-	client         *Client
-	sType          string
+	converter
+	client    *Client
+	sType     string
+	claimDone bool
+	pps       []byte
+	sps       []byte
+	session   *Session
+	// The media connection is made with the first frame, within this context
+	ctx context.Context
+	// Channel of a multi-channel device (e.g. NVR). 0 for a camera
+	channel int
+}
+
+// converter turns raw DVRIP frames into generic ones, with durations and (optionally) camera times
+type converter struct {
 	lastIFrameMeta *frame.Meta
 	pts            *PTS
-	claimDone      bool
-	pps            []byte
-	sps            []byte
+	// Follows the camera's clock. Optional.
+	Clock *Clock
 }
 
-func NewMonitor(ctx context.Context, address string, sType string, args ...string) (*Monitor, error) {
-	client, err := NewClient(ctx, address, args...)
-	if err != nil {
-		return nil, err
-	}
+// NewMonitor streams the channel's stream ("0" is the main one, "1" the extra one) within the session.
+// It connects to the device with the first frame asked for. The session is released on ShutDown().
+func NewMonitor(ctx context.Context, session *Session, channel int, sType string) *Monitor {
 	sMap := map[string]string{
 		"0": "Main",
 		"1": "Extra",
 	}
 	return &Monitor{
-		client:    client,
+		session:   session,
+		ctx:       ctx,
+		channel:   channel,
 		sType:     sMap[sType],
 		claimDone: false,
-	}, nil
+	}
 }
 
 func (me *Monitor) ShutDown() {
@@ -47,11 +60,45 @@ func (me *Monitor) ShutDown() {
 		me.client.Disconnect()
 		me.client = nil
 	}
+	if me.session != nil {
+		me.session.Release()
+		me.session = nil
+	}
+}
+
+// claim connects to the device and starts streaming, within the session if the device lets it
+func (me *Monitor) claim() error {
+	client, _, err := me.session.mediaClient(me.ctx, func(c *Client, joined bool) error {
+		return me.start(c)
+	})
+	if err != nil {
+		return err
+	}
+	me.client = client
+	return nil
+}
+
+// start starts streaming over the connection
+func (me *Monitor) start(c *Client) error {
+	return c.Monitor(me.channel, me.sType)
+}
+
+// AudioFormat is always G.711 A-law, 8 kHz mono, with DVRIP
+func (me *Monitor) AudioFormat() *gframe.AudioFormat {
+	return audioFormat()
+}
+
+func audioFormat() *gframe.AudioFormat {
+	return &gframe.AudioFormat{
+		Codec:      gframe.AudioCodecPCMA,
+		SampleRate: int(frame.ExpectedAudioSampleRate),
+		Channels:   1,
+	}
 }
 
 func (me *Monitor) GetFrame() (*gframe.Frame, error) {
 	if !me.claimDone {
-		err := me.client.Monitor(me.sType)
+		err := me.claim()
 		if err == nil {
 			me.claimDone = true
 		} else {
@@ -62,6 +109,11 @@ func (me *Monitor) GetFrame() (*gframe.Frame, error) {
 	if err != nil {
 		return nil, err
 	}
+	return me.convert(raw)
+}
+
+func (me *converter) convert(raw *frame.RawFrame) (*gframe.Frame, error) {
+	var err error
 	if raw.Type == frame.T_VideoI {
 		me.lastIFrameMeta = raw.GetMeta()
 		if me.pts == nil || me.pts.FPS != me.lastIFrameMeta.FPS {
@@ -84,6 +136,14 @@ func (me *Monitor) GetFrame() (*gframe.Frame, error) {
 	}
 	if raw.Type == frame.T_VideoI || raw.Type == frame.T_VideoP {
 		F.Duration = time.Duration(me.pts.Next()) * time.Millisecond
+		if me.Clock != nil {
+			if raw.Type == frame.T_VideoI {
+				me.Clock.keyFrame(meta.DateTime)
+			}
+			if t := me.Clock.next(F.Duration); me.Clock.Stamp {
+				F.Time = t
+			}
+		}
 		F.IsVideo = true
 		F.IsVideoKeyFrame = raw.Type == frame.T_VideoI
 		F.IsHEVC = meta.MediaType == "H265"
@@ -103,30 +163,40 @@ func (me *Monitor) getRawFrame() (*frame.RawFrame, error) {
 	if err != nil {
 		return nil, err
 	}
-	if message.Code == packet.KEEPALIVE_RSP {
-		// Ignore and read the next one
+	switch message.Code {
+	case packet.MONITOR_DATA:
+	default:
+		// Ignore anything else (e.g. keep-alive responses) and read until get a media message
 		return me.getRawFrame()
 	}
-	if message.Code != packet.MONITOR_DATA { // read until get a media message
-		return nil, fmt.Errorf("Expected monitor data but received code %d", message.Code)
+	raw, err := parseRawFrame(message.Data)
+	if err == errNotAFrame {
+		// Ignore and read the next one
+		return me.getRawFrame()
 	}
-	reader := bytes.NewReader(message.Data)
+	return raw, err
+}
+
+var errNotAFrame = errors.New("not a media frame")
+
+// parseRawFrame parses the media frame (of a monitor or a playback message)
+func parseRawFrame(msg []byte) (*frame.RawFrame, error) {
+	reader := bytes.NewReader(msg)
 	var headerTop frame.HeaderCommon
-	err = binary.Read(reader, binary.LittleEndian, &headerTop) // here it doesn't actually matter whether Big or Little Endian as all the fields are 1-byte long
+	err := binary.Read(reader, binary.LittleEndian, &headerTop) // here it doesn't actually matter whether Big or Little Endian as all the fields are 1-byte long
 	if err != nil {
 		return nil, err
 	}
 	if headerTop.B1 != 0x00 || headerTop.B2 != 0x00 || headerTop.B3 != 0x01 {
 		// fmt.Println("Wrong first 3 bytes of a what is expected to be a frame")
-		// Ignore and read the next one
-		return me.getRawFrame()
+		return nil, errNotAFrame
 	}
 	header := frame.TMap[headerTop.Type]()
 	err = binary.Read(reader, binary.LittleEndian, header)
 	if err != nil {
 		return nil, err
 	}
-	factualDataLength := uint32(len(message.Data) - int(header.GetOwnLength()))
+	factualDataLength := uint32(len(msg) - int(header.GetOwnLength()))
 	if header.GetLength() != factualDataLength {
 		diff := factualDataLength - header.GetLength()
 		if diff != 168 { // 168 appears to be frequent and benign
@@ -13,14 +13,55 @@ const (
 	KEEPALIVE_REQ   Code = 1005
 	KEEPALIVE_RSP   Code = 1006
 
+	SYSINFO_REQ Code = 1020
+	SYSINFO_RSP Code = 1021
+
+	ABILITY_REQ Code = 1360
+	ABILITY_RSP Code = 1361
+
+	PTZ_REQ Code = 1400
+	PTZ_RSP Code = 1401
+
 	MONITOR_REQ       Code = 1410
 	MONITOR_RSP       Code = 1411
 	MONITOR_DATA      Code = 1412
 	MONITOR_CLAIM     Code = 1413
 	MONITOR_CLAIM_RSP Code = 1414
 
+	PLAYBACK_REQ       Code = 1420
+	PLAYBACK_RSP       Code = 1421
+	PLAYBACK_CLAIM     Code = 1424
+	PLAYBACK_CLAIM_RSP Code = 1425
+	PLAYBACK_DATA      Code = 1426
+
+	// Talkback: claimed on a connection of its own, which then carries the audio to the device (and from it)
+	TALK_REQ       Code = 1430
+	TALK_RSP       Code = 1431
+	TALK_DATA      Code = 1432
+	TALK_DATA_BACK Code = 1433
+	TALK_CLAIM     Code = 1434
+	TALK_CLAIM_RSP Code = 1435
+
+	FILEQUERY_REQ Code = 1440
+	FILEQUERY_RSP Code = 1441
+
 	SYSMANAGER_REQ Code = 1450
 	SYSMANAGER_RSP Code = 1451
+	TIMEQUERY_REQ  Code = 1452
+	TIMEQUERY_RSP  Code = 1453
+
+	// Subscribes the connection to alarms, which the device pushes as ALARM_INFO (or NET_ALARM) messages
+	ALARM_SET_REQ Code = 1500
+	ALARM_SET_RSP Code = 1501
+	ALARM_INFO    Code = 1504
+	NET_ALARM     Code = 1506
+
+	// Broadcast over UDP (port 34569) to find the devices on the LAN
+	IPSEARCH_REQ Code = 1530
+	IPSEARCH_RSP Code = 1531
+
+	SNAP_REQ Code = 1560
+	SNAP_RSP Code = 1561
 )
 
 // const (
@@ -60,6 +101,16 @@ const (
 // )
 
 var Commands = map[Code]string{
+	SYSINFO_REQ:    "SystemInfo",
+	ABILITY_REQ:    "SystemFunction",
+	PTZ_REQ:        "OPPTZControl",
 	MONITOR_CLAIM:  "OPMonitor",
+	PLAYBACK_REQ:   "OPPlayBack",
+	PLAYBACK_CLAIM: "OPPlayBack",
+	TALK_REQ:       "OPTalk",
+	TALK_CLAIM:     "OPTalk",
+	FILEQUERY_REQ:  "OPFileQuery",
 	SYSMANAGER_REQ: "OPTimeSetting",
+	TIMEQUERY_REQ:  "OPTimeQuery",
+	SNAP_REQ:       "OPSNAP",
 }
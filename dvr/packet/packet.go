@@ -12,7 +12,7 @@ func (p Packet) GetInfoString() string {
 }
 
 func (p Packet) IsMedia() bool {
-	return p.Header.Code == MONITOR_DATA
+	return p.Header.Code == MONITOR_DATA || p.Header.Code == PLAYBACK_DATA
 }
 
 func (p Packet) IsSingle() bool {
@@ -0,0 +1,198 @@
+package dvrip
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// PTZ commands of OPPTZControl
+const (
+	ptzUp        = "DirectionUp"
+	ptzDown      = "DirectionDown"
+	ptzLeft      = "DirectionLeft"
+	ptzRight     = "DirectionRight"
+	ptzLeftUp    = "DirectionLeftUp"
+	ptzLeftDown  = "DirectionLeftDown"
+	ptzRightUp   = "DirectionRightUp"
+	ptzRightDown = "DirectionRightDown"
+	ptzZoomIn    = "ZoomTile"
+	ptzZoomOut   = "ZoomWide"
+	ptzFocusNear = "FocusNear"
+	ptzFocusFar  = "FocusFar"
+	ptzIrisClose = "IrisSmall"
+	ptzIrisOpen  = "IrisLarge"
+	ptzSetPreset = "SetPreset"
+	ptzGoPreset  = "GotoPreset"
+	ptzDelPreset = "ClearPreset"
+	ptzStartTour = "StartTour"
+	ptzStopTour  = "StopTour"
+)
+
+const (
+	// A movement starts with the Preset parameter set to this, and goes on until the same command with -1
+	ptzMoveStart = 65535
+	ptzMoveStop  = -1
+	ptzNoPreset  = -1
+	ptzNoTour    = 0
+	// Speed ("Step") of movements
+	ptzMaxSpeed     = 8
+	ptzDefaultSpeed = 5
+)
+
+// PTZ movements, as named in PTZ requests
+var ptzMovements = map[string]string{
+	"up":        ptzUp,
+	"down":      ptzDown,
+	"left":      ptzLeft,
+	"right":     ptzRight,
+	"upleft":    ptzLeftUp,
+	"downleft":  ptzLeftDown,
+	"upright":   ptzRightUp,
+	"downright": ptzRightDown,
+	"zoomin":    ptzZoomIn,
+	"zoomout":   ptzZoomOut,
+	"focusnear": ptzFocusNear,
+	"focusfar":  ptzFocusFar,
+	"irisclose": ptzIrisClose,
+	"irisopen":  ptzIrisOpen,
+}
+
+var ErrPTZMovement = errors.New("unknown PTZ movement")
+
+func (c *Client) ptz(channel int, command string, step int, preset int, tour int) error {
+	resp, err := c.Request(packet.PTZ_REQ, map[string]interface{}{
+		"Command": command,
+		"Parameter": map[string]interface{}{
+			"AUX":      map[string]interface{}{"Number": 0, "Status": "On"},
+			"Channel":  channel,
+			"MenuOpts": "Enter",
+			"POINT":    map[string]interface{}{"bottom": 0, "left": 0, "right": 0, "top": 0},
+			"Pattern":  "SetBegin",
+			"Preset":   preset,
+			"Step":     step,
+			"Tour":     tour,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	return checkStatus(resp.Data)
+}
+
+// PTZMove starts the movement (pan/tilt in a direction, zoom, focus or iris; see PTZRequest) at the speed of 1 to 8.
+// It goes on until PTZStop.
+func (c *Client) PTZMove(channel int, movement string, speed int) error {
+	command, ok := ptzMovements[movement]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrPTZMovement, movement)
+	}
+	if speed <= 0 {
+		speed = ptzDefaultSpeed
+	} else if speed > ptzMaxSpeed {
+		speed = ptzMaxSpeed
+	}
+	return c.ptz(channel, command, speed, ptzMoveStart, ptzNoTour)
+}
+
+// PTZStop stops the movement started by PTZMove
+func (c *Client) PTZStop(channel int, movement string) error {
+	command, ok := ptzMovements[movement]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrPTZMovement, movement)
+	}
+	return c.ptz(channel, command, 0, ptzMoveStop, ptzNoTour)
+}
+
+// PTZSetPreset saves the current position as the preset
+func (c *Client) PTZSetPreset(channel int, preset int) error {
+	return c.ptz(channel, ptzSetPreset, 0, preset, ptzNoTour)
+}
+
+// PTZGotoPreset moves to the preset position
+func (c *Client) PTZGotoPreset(channel int, preset int) error {
+	return c.ptz(channel, ptzGoPreset, 0, preset, ptzNoTour)
+}
+
+// PTZClearPreset deletes the preset
+func (c *Client) PTZClearPreset(channel int, preset int) error {
+	return c.ptz(channel, ptzDelPreset, 0, preset, ptzNoTour)
+}
+
+// PTZStartTour starts touring the presets of the tour
+func (c *Client) PTZStartTour(channel int, tour int) error {
+	return c.ptz(channel, ptzStartTour, 0, ptzNoPreset, tour)
+}
+
+// PTZStopTour stops the tour
+func (c *Client) PTZStopTour(channel int, tour int) error {
+	return c.ptz(channel, ptzStopTour, 0, ptzNoPreset, tour)
+}
+
+// PTZ actions of PTZRequest
+const (
+	PTZActionMove        = "move"
+	PTZActionStop        = "stop"
+	PTZActionSetPreset   = "setpreset"
+	PTZActionGotoPreset  = "gotopreset"
+	PTZActionClearPreset = "clearpreset"
+	PTZActionStartTour   = "starttour"
+	PTZActionStopTour    = "stoptour"
+)
+
+// PTZRequest is a PTZ command of a camera or an NVR channel
+type PTZRequest struct {
+	Action string `json:"action"`
+	// Movement of move and stop: up, down, left, right, upleft, downleft, upright, downright,
+	// zoomin, zoomout, focusnear, focusfar, irisclose, irisopen
+	Movement string `json:"movement"`
+	// Speed of move, 1 to 8
+	Speed  int `json:"speed"`
+	Preset int `json:"preset"`
+	Tour   int `json:"tour"`
+	// Duration of move in milliseconds, after which it is stopped automatically. Without it, it goes on until stop.
+	DurationMs int `json:"duration"`
+}
+
+// Validate checks the request without sending it
+func (r *PTZRequest) Validate() error {
+	switch r.Action {
+	case PTZActionMove, PTZActionStop:
+		if _, ok := ptzMovements[r.Movement]; !ok {
+			return fmt.Errorf("%w: %q", ErrPTZMovement, r.Movement)
+		}
+	case PTZActionSetPreset, PTZActionGotoPreset, PTZActionClearPreset:
+		if r.Preset <= 0 {
+			return errors.New("preset must be positive")
+		}
+	case PTZActionStartTour, PTZActionStopTour:
+	default:
+		return fmt.Errorf("unknown PTZ action %q", r.Action)
+	}
+	if r.DurationMs < 0 {
+		return errors.New("duration must not be negative")
+	}
+	return nil
+}
+
+// PTZ sends the request to the channel (0 for a camera)
+func (c *Client) PTZ(channel int, r *PTZRequest) error {
+	switch r.Action {
+	case PTZActionMove:
+		return c.PTZMove(channel, r.Movement, r.Speed)
+	case PTZActionStop:
+		return c.PTZStop(channel, r.Movement)
+	case PTZActionSetPreset:
+		return c.PTZSetPreset(channel, r.Preset)
+	case PTZActionGotoPreset:
+		return c.PTZGotoPreset(channel, r.Preset)
+	case PTZActionClearPreset:
+		return c.PTZClearPreset(channel, r.Preset)
+	case PTZActionStartTour:
+		return c.PTZStartTour(channel, r.Tour)
+	case PTZActionStopTour:
+		return c.PTZStopTour(channel, r.Tour)
+	}
+	return r.Validate()
+}
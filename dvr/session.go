@@ -0,0 +1,231 @@
+package dvrip
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/greendrake/cctv/dvr/message"
+	"github.com/greendrake/cctv/dvr/packet"
+	"github.com/greendrake/cctv/util"
+)
+
+const defaultKeepAliveInterval = 20 * time.Second
+
+var ErrSessionClosed = errors.New("DVRIP session closed")
+
+// Session is a login to a device shared by all its users, e.g. the monitors of the channels of an NVR,
+// so that the device is logged in only once.
+// The login is held by a control connection kept alive by the session. The media of each monitor
+// goes over a connection of its own, which joins the session instead of logging in again.
+type Session struct {
+	key      string
+	address  string
+	user     string
+	password string
+	control  *Client
+	// Serialises the commands sent over the control connection
+	mutex  sync.Mutex
+	refs   int
+	ctx    context.Context
+	cancel context.CancelFunc
+	// Set once the device refuses a connection joining the session
+	joinRefused atomic.Bool
+	// Closed once the login is done, successfully (control set) or not (err set)
+	ready chan struct{}
+	err   error
+}
+
+var (
+	sessions      = map[string]*Session{}
+	sessionsMutex sync.Mutex
+)
+
+// AcquireSession returns the session with the device, logging in if there is none yet.
+// The channels of a device starting together wait for one login, without holding up other devices.
+// Each successful call must be paired with Release().
+func AcquireSession(ctx context.Context, address string, user string, password string) (*Session, error) {
+	key := address + "\x00" + user + "\x00" + password
+	sessionsMutex.Lock()
+	if s, ok := sessions[key]; ok {
+		s.refs++
+		sessionsMutex.Unlock()
+		select {
+		case <-s.ready:
+		case <-ctx.Done():
+			s.Release()
+			return nil, ctx.Err()
+		}
+		if s.err != nil {
+			s.Release()
+			return nil, s.err
+		}
+		return s, nil
+	}
+	s := &Session{
+		key:      key,
+		address:  address,
+		user:     user,
+		password: password,
+		refs:     1,
+		ready:    make(chan struct{}),
+	}
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	sessions[key] = s
+	sessionsMutex.Unlock()
+	control, err := NewClient(ctx, address, user, password)
+	if err != nil {
+		s.err = err
+		s.forget()
+		close(s.ready)
+		s.Release()
+		return nil, err
+	}
+	s.control = control
+	close(s.ready)
+	go s.keepAlive()
+	return s, nil
+}
+
+// Release logs out of the device once the session has no users left.
+// Until the login is done, the caller which logs in holds a reference, so it is never the last one before that.
+func (s *Session) Release() {
+	sessionsMutex.Lock()
+	s.refs--
+	last := s.refs == 0
+	if last && sessions[s.key] == s {
+		delete(sessions, s.key)
+	}
+	sessionsMutex.Unlock()
+	if last {
+		s.close()
+	}
+}
+
+func (s *Session) close() {
+	s.cancel()
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.control != nil {
+		s.control.Disconnect()
+		s.control = nil
+	}
+}
+
+// lose ends the session once the login is lost: the next AcquireSession() logs in anew, and the connections of the
+// current users are closed, so that they fail right away and make new ones. They still have to release the session.
+func (s *Session) lose() {
+	s.forget()
+	s.close()
+}
+
+// forget makes the next AcquireSession() log in anew. The current users keep the session until they release it.
+func (s *Session) forget() {
+	sessionsMutex.Lock()
+	defer sessionsMutex.Unlock()
+	if sessions[s.key] == s {
+		delete(sessions, s.key)
+	}
+}
+
+func (s *Session) keepAlive() {
+	interval := defaultKeepAliveInterval
+	if i := s.control.keepAliveInterval; i > 0 {
+		interval = time.Duration(i) * time.Second
+	}
+	for util.SleepCtx(s.ctx, interval) {
+		if _, err := s.Command(packet.KEEPALIVE_REQ, nil); err != nil {
+			if s.ctx.Err() == nil {
+				log.Printf("DVRIP session with %v lost: %v", s.address, err)
+				s.lose()
+			}
+			return
+		}
+	}
+}
+
+// Command sends the command over the control connection and returns the response to it
+func (s *Session) Command(command packet.Code, data interface{}) (*message.Message, error) {
+	var m *message.Message
+	err := s.Do(func(c *Client) (err error) {
+		m, err = c.Request(command, data)
+		return
+	})
+	return m, err
+}
+
+// Do runs f with the control connection, exclusively
+func (s *Session) Do(f func(c *Client) error) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.control == nil {
+		return ErrSessionClosed
+	}
+	return f(s.control)
+}
+
+// joinClient connects to the device and joins the session, without logging in
+func (s *Session) joinClient(ctx context.Context) (*Client, error) {
+	s.mutex.Lock()
+	control := s.control
+	s.mutex.Unlock()
+	if control == nil {
+		return nil, ErrSessionClosed
+	}
+	conn, err := dial(ctx, control.settings.Address)
+	if err != nil {
+		return nil, err
+	}
+	return &Client{
+		settings:          control.settings,
+		session:           control.session,
+		c:                 conn,
+		keepAliveInterval: control.keepAliveInterval,
+		lastKeepAlivePing: time.Now().Unix(),
+		Ctx:               ctx,
+	}, nil
+}
+
+// mediaClient connects to the device for a media connection and starts the media over it with start. The connection
+// joins the session, unless the device does not let it, in which case it logs in separately. Returns whether it has joined.
+func (s *Session) mediaClient(ctx context.Context, start func(c *Client, joined bool) error) (*Client, bool, error) {
+	if !s.joinRefused.Load() {
+		client, err := s.joinClient(ctx)
+		if err != nil {
+			return nil, false, err
+		}
+		if err = start(client, true); err == nil {
+			s.watch(client)
+			return client, true, nil
+		}
+		client.Disconnect()
+		if !s.joinRefused.Swap(true) {
+			log.Printf("DVRIP device %v does not let connections join the session (%v), logging in separately", s.address, err)
+		}
+	}
+	client, err := s.loginClient(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	if err = start(client, false); err != nil {
+		client.Disconnect()
+		return nil, false, err
+	}
+	s.watch(client)
+	return client, false, nil
+}
+
+// watch closes the media connection when the session ends, unless it is disconnected before
+func (s *Session) watch(c *Client) {
+	c.unwatch = context.AfterFunc(s.ctx, func() {
+		c.c.Close()
+	})
+}
+
+// loginClient connects to the device and logs in separately, for devices that do not let connections join a session
+func (s *Session) loginClient(ctx context.Context) (*Client, error) {
+	return NewClient(ctx, s.address, s.user, s.password)
+}
@@ -0,0 +1,130 @@
+package dvrip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// fakeSession makes a logged in session, with the control connection given, and media connections made to mediaAddress
+func fakeSession(control net.Conn, mediaAddress string) *Session {
+	s := &Session{
+		key:     "fake\x00admin\x00",
+		address: "fake",
+		refs:    1,
+		ready:   make(chan struct{}),
+		control: &Client{
+			settings:          &Settings{Address: mediaAddress},
+			c:                 control,
+			keepAliveInterval: 1,
+			Ctx:               context.Background(),
+		},
+	}
+	close(s.ready)
+	s.ctx, s.cancel = context.WithCancel(context.Background())
+	sessionsMutex.Lock()
+	sessions[s.key] = s
+	sessionsMutex.Unlock()
+	return s
+}
+
+func TestSessionLost(t *testing.T) {
+	// The device side of the media connections
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+	control, device := net.Pipe()
+	s := fakeSession(control, l.Addr().String())
+	defer s.Release()
+
+	media, joined, err := s.mediaClient(context.Background(), func(c *Client, joined bool) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !joined {
+		t.Error("Expected the media connection to join the session")
+	}
+	defer media.Disconnect()
+	mediaDevice := <-accepted
+	defer mediaDevice.Close()
+	// Open as long as the session is
+	mediaDevice.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	var ne net.Error
+	if _, err := mediaDevice.Read(make([]byte, 1)); !errors.As(err, &ne) || !ne.Timeout() {
+		t.Fatalf("Expected the media connection open, got %v", err)
+	}
+
+	// The device drops the control connection on the next keep-alive
+	go func() {
+		device.Read(make([]byte, 1))
+		device.Close()
+	}()
+	done := make(chan struct{})
+	go func() {
+		s.keepAlive()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the keep-alive to fail")
+	}
+
+	// The users learn right away
+	mediaDevice.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err := mediaDevice.Read(make([]byte, 1)); err == nil || errors.As(err, &ne) && ne.Timeout() {
+		t.Errorf("Expected the media connection closed, got %v", err)
+	}
+	if _, err := s.Command(packet.KEEPALIVE_REQ, nil); err != ErrSessionClosed {
+		t.Errorf("Expected %v, got %v", ErrSessionClosed, err)
+	}
+	// And the next one logs in anew
+	sessionsMutex.Lock()
+	_, ok := sessions[s.key]
+	sessionsMutex.Unlock()
+	if ok {
+		t.Error("Expected the session forgotten")
+	}
+}
+
+func TestSessionMediaDisconnected(t *testing.T) {
+	control, device := net.Pipe()
+	defer device.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+	s := fakeSession(control, l.Addr().String())
+	media, _, err := s.mediaClient(context.Background(), func(c *Client, joined bool) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	media.Disconnect()
+	// Disconnecting stops watching the session
+	if media.unwatch() {
+		t.Error("Expected the media connection unwatched once disconnected")
+	}
+	s.Release()
+}
@@ -0,0 +1,59 @@
+package dvrip
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// The device takes a while to encode the picture
+const snapshotTimeout = 5 * time.Second
+
+var (
+	jpegStart     = []byte{0xFF, 0xD8, 0xFF}
+	ErrNoSnapshot = errors.New("no JPEG in the snapshot response")
+)
+
+// notYet tells whether nothing has been received before the read timeout, so reading can be retried.
+// (A timeout in the middle of a packet is TimeoutError, after which the connection is out of sync.)
+func notYet(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+// Snapshot takes a still picture of the channel (0 for a camera) and returns it as JPEG
+func (c *Client) Snapshot(channel int) ([]byte, error) {
+	params, err := c.makeCommand(packet.SNAP_REQ, map[string]interface{}{
+		"Channel": channel,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err = c.send(packet.SNAP_REQ, params); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(snapshotTimeout)
+	for {
+		m, err := c.GetMessage()
+		if err != nil {
+			if notYet(err) && time.Now().Before(deadline) {
+				continue
+			}
+			return nil, err
+		}
+		if m.Code != packet.SNAP_RSP {
+			continue
+		}
+		if i := bytes.Index(m.Data, jpegStart); i >= 0 {
+			return m.Data[i:], nil
+		}
+		// A failure is reported in JSON
+		if err = checkStatus(m.Data); err != nil {
+			return nil, err
+		}
+		return nil, ErrNoSnapshot
+	}
+}
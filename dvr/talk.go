@@ -0,0 +1,124 @@
+package dvrip
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+
+	"github.com/greendrake/cctv/dvr/frame"
+	"github.com/greendrake/cctv/dvr/message"
+	"github.com/greendrake/cctv/dvr/packet"
+)
+
+// The device plays G.711 A-law, 8 kHz mono, taking it in frames of this many bytes (40 ms)
+const talkFrameSize = 320
+
+var talkAudioFormat = map[string]interface{}{
+	"BitRate":    128,
+	"EncodeType": "G711_ALAW",
+	"SampleBit":  8,
+	"SampleRate": 8000,
+}
+
+// Talk streams audio to the speaker of the device (talkback). The device takes one at a time.
+type Talk struct {
+	client  *Client
+	session *Session
+	// Whether the connection joined the session (and so is started and stopped over the control connection)
+	joined    bool
+	sendMutex sync.Mutex
+	closeOnce sync.Once
+}
+
+// Talk claims the speaker of the device within the session. The session is released on Close().
+func (s *Session) Talk(ctx context.Context) (*Talk, error) {
+	t := &Talk{session: s}
+	client, joined, err := s.mediaClient(ctx, func(c *Client, joined bool) error {
+		resp, err := c.Request(packet.TALK_CLAIM, talkParams("Claim"))
+		if err != nil {
+			return err
+		}
+		if err = checkStatus(resp.Data); err != nil {
+			return err
+		}
+		t.client, t.joined = c, joined
+		return t.start()
+	})
+	if err != nil {
+		return nil, err
+	}
+	t.client, t.joined = client, joined
+	// Whatever the device sends back (e.g. the sound of its microphone) is not used, but has to be read
+	go func() {
+		for {
+			if _, err := client.GetMessage(); err != nil && !notYet(err) {
+				return
+			}
+		}
+	}()
+	return t, nil
+}
+
+func talkParams(action string) map[string]interface{} {
+	return map[string]interface{}{
+		"Action":      action,
+		"AudioFormat": talkAudioFormat,
+	}
+}
+
+// start starts the talk over the control connection, or over its own one if it has logged in separately
+func (t *Talk) start() error {
+	var resp *message.Message
+	var err error
+	if t.joined {
+		resp, err = t.session.Command(packet.TALK_REQ, talkParams("Start"))
+	} else {
+		resp, err = t.client.Request(packet.TALK_REQ, talkParams("Start"))
+	}
+	if err != nil {
+		return err
+	}
+	return checkStatus(resp.Data)
+}
+
+func (t *Talk) stop() error {
+	if t.joined {
+		_, err := t.session.Command(packet.TALK_REQ, talkParams("Stop"))
+		return err
+	}
+	t.sendMutex.Lock()
+	defer t.sendMutex.Unlock()
+	// The response is left to the reader
+	return t.client.Command(packet.TALK_REQ, talkParams("Stop"), false)
+}
+
+// Send plays G.711 A-law audio (8 kHz mono) through the speaker
+func (t *Talk) Send(alaw []byte) error {
+	t.sendMutex.Lock()
+	defer t.sendMutex.Unlock()
+	t.client.MaybePingKeepAlive()
+	for len(alaw) > 0 {
+		n := min(len(alaw), talkFrameSize)
+		// The same media frame header the device uses for its audio
+		data := make([]byte, 8, 8+n)
+		data[2] = 0x01
+		data[3] = byte(frame.T_Audio)
+		data[4] = 0x0E // G.711 A-law
+		data[5] = 0x02 // 8 kHz
+		binary.LittleEndian.PutUint16(data[6:], uint16(n))
+		if err := t.client.sendRaw(packet.TALK_DATA, append(data, alaw[:n]...)); err != nil {
+			return err
+		}
+		alaw = alaw[n:]
+	}
+	return nil
+}
+
+// Close stops the talk and releases the session
+func (t *Talk) Close() {
+	t.closeOnce.Do(func() {
+		t.stop()
+		t.client.Disconnect()
+		t.session.Release()
+	})
+}
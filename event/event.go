@@ -0,0 +1,59 @@
+package event
+
+import (
+	"fmt"
+	"github.com/greendrake/eventbus"
+	"time"
+)
+
+// Type of an event, regardless of the source
+type Type string
+
+const (
+	Motion    Type = "motion"
+	VideoLoss Type = "videoloss"
+	Blind     Type = "blind" // The camera is covered or blinded
+	Human     Type = "human"
+	Input     Type = "input"  // External alarm input of the device
+	Manual    Type = "manual" // Triggered by hand, e.g. over HTTP
+	Other     Type = "other"
+)
+
+// Event is something that starts or stops happening at a camera, e.g. motion
+type Event struct {
+	Camera  string `json:"camera"`
+	Channel int    `json:"channel"`
+	Type    Type   `json:"type"`
+	// Whether the event starts (otherwise it stops)
+	Start bool      `json:"start"`
+	Time  time.Time `json:"time"`
+	// As named by the source, e.g. "VideoMotion"
+	Name string `json:"name"`
+}
+
+func (e *Event) String() string {
+	state := "stop"
+	if e.Start {
+		state = "start"
+	}
+	return fmt.Sprintf("%v %v (%v) %v at %v", e.Camera, e.Type, e.Name, state, e.Time.Format(time.DateTime))
+}
+
+const topic = "event"
+
+// Bus delivers events to all subscribers. It can be used as is (zero value).
+type Bus struct {
+	eventbus.EventBus
+}
+
+// Subscribe calls f on every event published from now on.
+// f is called by the publisher synchronously, so it must not block.
+func (b *Bus) Subscribe(f func(e *Event)) {
+	b.On(topic, func(args ...any) {
+		f(args[0].(*Event))
+	})
+}
+
+func (b *Bus) Publish(e *Event) {
+	b.Trigger(topic, e)
+}
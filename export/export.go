@@ -0,0 +1,173 @@
+package export
+
+import (
+	"errors"
+	"fmt"
+	"github.com/greendrake/cctv/recindex"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	FormatMKV = "mkv"
+	FormatMP4 = "mp4"
+)
+
+var (
+	ErrNoFootage = errors.New("No recorded footage in the requested time range")
+	errDone      = errors.New("done")
+)
+
+// sink writes the clip into the target container
+type sink interface {
+	// begin is called before the first block, with the wall-clock time the clip starts at
+	begin(origin time.Time) error
+	writeVideo(timestamp time.Duration, keyframe bool, data []byte) error
+	writeAudio(timestamp time.Duration, data []byte) error
+	close() error
+}
+
+// FormatFromFileName guesses the format by the file extension, MKV by default
+func FormatFromFileName(name string) string {
+	if strings.EqualFold(filepath.Ext(name), ".mp4") {
+		return FormatMP4
+	}
+	return FormatMKV
+}
+
+// FileName makes a descriptive file name for a clip
+func FileName(cam string, stream string, from time.Time, to time.Time, format string) string {
+	return fmt.Sprintf("%v.%v.%v-%v.%v", cam, stream, from.Format("20060102-150405"), to.Format("150405"), format)
+}
+
+// Export cuts the [from, to) time range out of the recordings (oldest first, as returned by the index)
+// and remuxes it into a single MKV or MP4 file without re-encoding.
+// The clip starts at the key frame at or before "from", and its timestamps are rebased to start at 0.
+// MP4 clips are fragmented (same as webcast streams), have no audio, and carry the start time and the tags in their metadata.
+func Export(baseDir string, recs []*recindex.Recording, from time.Time, to time.Time, format string, w io.WriteSeeker) error {
+	if len(recs) == 0 {
+		return ErrNoFootage
+	}
+	tracks, tags, err := readFileHeader(filepath.Join(baseDir, recs[0].Path))
+	if err != nil {
+		return err
+	}
+	var s sink
+	switch format {
+	case FormatMKV:
+		s, err = newMKVSink(w, tracks, tags)
+	case FormatMP4:
+		s, err = newMP4Sink(w, tracks, tags)
+	default:
+		err = fmt.Errorf("Unsupported export format: %v", format)
+	}
+	if err != nil {
+		return err
+	}
+	c := &cutter{
+		sink: s,
+		from: from,
+		to:   to,
+	}
+	for _, rec := range recs {
+		c.chunkStart = rec.Start
+		err = readChunk(filepath.Join(baseDir, rec.Path), c.handle)
+		if err == errDone {
+			break
+		}
+		if err != nil {
+			s.close()
+			return err
+		}
+	}
+	if !c.started {
+		s.close()
+		return ErrNoFootage
+	}
+	return s.close()
+}
+
+// cutter picks the blocks within the time range and rebases their timestamps
+type cutter struct {
+	sink       sink
+	from       time.Time
+	to         time.Time
+	chunkStart time.Time
+	started    bool
+	origin     time.Time
+	// Blocks since the last key frame before "from", wall-clock time-stamped
+	gop          []*block
+	gopTimes     []time.Time
+	lastVideo    time.Duration
+	lastAudio    time.Duration
+	videoWritten bool
+	audioWritten bool
+}
+
+func (c *cutter) handle(b *block) error {
+	t := c.chunkStart.Add(b.timestamp)
+	if !c.to.IsZero() && !t.Before(c.to) {
+		if b.video {
+			return errDone
+		}
+		return nil
+	}
+	if !c.started {
+		if t.Before(c.from) {
+			if b.video && b.keyframe {
+				c.gop = nil
+				c.gopTimes = nil
+			}
+			if len(c.gop) > 0 || (b.video && b.keyframe) {
+				c.gop = append(c.gop, b)
+				c.gopTimes = append(c.gopTimes, t)
+			}
+			return nil
+		}
+		if len(c.gop) == 0 {
+			// No key frame before "from" (e.g. the footage starts later): wait for one
+			if !b.video || !b.keyframe {
+				return nil
+			}
+			c.origin = t
+		} else {
+			c.origin = c.gopTimes[0]
+		}
+		c.started = true
+		if err := c.sink.begin(c.origin); err != nil {
+			return err
+		}
+		for i, g := range c.gop {
+			if err := c.write(g, c.gopTimes[i]); err != nil {
+				return err
+			}
+		}
+		c.gop = nil
+		c.gopTimes = nil
+	}
+	return c.write(b, t)
+}
+
+// write makes sure timestamps are monotonic per track, as chunk boundaries may overlap slightly
+func (c *cutter) write(b *block, t time.Time) error {
+	ts := t.Sub(c.origin)
+	if ts < 0 {
+		return nil
+	}
+	if b.video {
+		if c.videoWritten && ts <= c.lastVideo {
+			ts = c.lastVideo + time.Millisecond
+		}
+		c.lastVideo = ts
+		c.videoWritten = true
+		return c.sink.writeVideo(ts, b.keyframe, b.data)
+	}
+	if c.audioWritten && ts <= c.lastAudio {
+		ts = c.lastAudio + time.Millisecond
+	}
+	c.lastAudio = ts
+	c.audioWritten = true
+	return c.sink.writeAudio(ts, b.data)
+}
@@ -0,0 +1,112 @@
+package export
+
+import (
+	"encoding/binary"
+	"fmt"
+	"github.com/greendrake/cctv/muxer/ebml/core"
+	"github.com/greendrake/cctv/muxer/ebml/matroska"
+	"github.com/greendrake/cctv/muxer/ebml/webm"
+	"io"
+	"time"
+)
+
+const (
+	waveFormatALaw  = 6
+	waveFormatMULaw = 7
+)
+
+type mkvSink struct {
+	w        io.WriteSeeker
+	tracks   []matroska.Track
+	tags     []matroska.Tag
+	mkv      *matroska.Matroska
+	hasAudio bool
+}
+
+// nopCloser lets the caller close the target file
+type nopCloser struct {
+	io.WriteSeeker
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// newTrack makes a track for writing what was read from a track described by the entry
+func newTrack(t webm.TrackEntry) (matroska.Track, error) {
+	sampleRate, channels := 8000, 1
+	if t.Audio != nil {
+		sampleRate, channels = int(t.Audio.SamplingFrequency), int(t.Audio.Channels)
+	}
+	switch t.CodecID {
+	case core.VideoCodecMPEGHISOHEVC:
+		return matroska.NewTrackH265(), nil
+	case core.VideoCodecMPEG4ISOAVC:
+		return matroska.NewTrackH264(), nil
+	case core.AudioCodecAAC:
+		return matroska.NewTrackAAC(sampleRate, channels, matroska.WithAACConfig(t.CodecPrivate)), nil
+	case core.AudioCodecMSACM:
+		// CodecPrivate is WAVEFORMATEX, starting with the format tag
+		if len(t.CodecPrivate) >= 2 {
+			switch binary.LittleEndian.Uint16(t.CodecPrivate) {
+			case waveFormatALaw:
+				return matroska.NewTrackPCMA(sampleRate, channels), nil
+			case waveFormatMULaw:
+				return matroska.NewTrackPCMU(sampleRate, channels), nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Unsupported codec: %v", t.CodecID)
+}
+
+// newMKVSink makes a sink keeping the tracks and the tags (describing the source) of the recordings
+func newMKVSink(w io.WriteSeeker, entries []webm.TrackEntry, tags []matroska.Tag) (*mkvSink, error) {
+	s := &mkvSink{
+		w:    w,
+		tags: tags,
+	}
+	hasVideo := false
+	for _, e := range entries {
+		if (e.TrackType == core.TrackTypeVideo && hasVideo) || (e.TrackType == core.TrackTypeAudio && s.hasAudio) {
+			continue
+		}
+		t, err := newTrack(e)
+		if err != nil {
+			return nil, err
+		}
+		hasVideo = hasVideo || t.IsVideo()
+		s.hasAudio = s.hasAudio || t.IsAudio()
+		s.tracks = append(s.tracks, t)
+	}
+	if !hasVideo {
+		return nil, fmt.Errorf("No video track")
+	}
+	return s, nil
+}
+
+// begin opens the file once the start time of the clip is known, as it goes into the header
+func (s *mkvSink) begin(origin time.Time) error {
+	var err error
+	s.mkv, err = matroska.OpenWithOptions(nopCloser{s.w}, s.tracks, matroska.WithDateUTC(origin), matroska.WithTags(s.tags...))
+	return err
+}
+
+func (s *mkvSink) writeVideo(timestamp time.Duration, keyframe bool, data []byte) error {
+	_, err := s.mkv.WriteVideo(timestamp, data)
+	return err
+}
+
+func (s *mkvSink) writeAudio(timestamp time.Duration, data []byte) error {
+	if !s.hasAudio {
+		return nil
+	}
+	_, err := s.mkv.WriteAudio(timestamp, data)
+	return err
+}
+
+func (s *mkvSink) close() error {
+	if s.mkv != nil {
+		s.mkv.Close()
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package export
+
+import (
+	"errors"
+	muxercore "github.com/greendrake/cctv/muxer/core"
+	"github.com/greendrake/cctv/muxer/ebml/core"
+	"github.com/greendrake/cctv/muxer/ebml/matroska"
+	"github.com/greendrake/cctv/muxer/ebml/webm"
+	"github.com/greendrake/cctv/muxer/mp4"
+	"io"
+	"log"
+	"time"
+)
+
+// Same as webcast
+const mp4ClockRate uint32 = 90000
+
+type mp4Sink struct {
+	w     io.Writer
+	codec string
+	tags  []mp4.Tag
+	// The wall-clock time the clip starts at
+	origin time.Time
+	muxer  *mp4.Muxer
+	// Each frame is written once the next one arrives, as its duration is needed
+	pending          []byte
+	pendingTimestamp time.Duration
+}
+
+// newMP4Sink makes a sink keeping the video track and the tags (describing the source) of the recordings
+func newMP4Sink(w io.Writer, entries []webm.TrackEntry, tags []matroska.Tag) (*mp4Sink, error) {
+	s := &mp4Sink{w: w}
+	for _, t := range tags {
+		s.tags = append(s.tags, mp4.Tag{Name: t.Name, Value: t.Value})
+	}
+	for _, e := range entries {
+		if e.TrackType == core.TrackTypeAudio {
+			log.Printf("MP4 export drops the audio track (%v), export to MKV to keep it", e.CodecID)
+			break
+		}
+	}
+	for _, e := range entries {
+		if e.TrackType == core.TrackTypeVideo {
+			switch e.CodecID {
+			case core.VideoCodecMPEGHISOHEVC:
+				s.codec = muxercore.CodecH265
+				return s, nil
+			case core.VideoCodecMPEG4ISOAVC:
+				s.codec = muxercore.CodecH264
+				return s, nil
+			}
+			return nil, errors.New("MP4 export supports H264 and H265 video only")
+		}
+	}
+	return nil, errors.New("No video track")
+}
+
+// begin keeps the start time of the clip, which goes into the init segment
+func (s *mp4Sink) begin(origin time.Time) error {
+	s.origin = origin
+	return nil
+}
+
+func (s *mp4Sink) writeVideo(timestamp time.Duration, keyframe bool, data []byte) error {
+	if s.muxer == nil {
+		if !keyframe {
+			return nil
+		}
+		s.muxer = &mp4.Muxer{CreationTime: s.origin, Tags: s.tags}
+		segment, err := s.muxer.GetInit(s.codec, data, mp4ClockRate)
+		if err != nil {
+			return err
+		}
+		if _, err = s.w.Write(segment); err != nil {
+			return err
+		}
+	}
+	if err := s.flush(timestamp - s.pendingTimestamp); err != nil {
+		return err
+	}
+	s.pending = data
+	s.pendingTimestamp = timestamp
+	return nil
+}
+
+func (s *mp4Sink) flush(duration time.Duration) error {
+	if s.pending == nil {
+		return nil
+	}
+	_, err := s.w.Write(s.muxer.GetPayload(0, &s.pending, uint32(duration*time.Duration(mp4ClockRate)/time.Second)))
+	s.pending = nil
+	return err
+}
+
+// The MP4 muxer has no audio support
+func (s *mp4Sink) writeAudio(timestamp time.Duration, data []byte) error {
+	return nil
+}
+
+func (s *mp4Sink) close() error {
+	return s.flush(40 * time.Millisecond)
+}
@@ -0,0 +1,116 @@
+package export
+
+import (
+	"github.com/greendrake/cctv/muxer/ebml"
+	"github.com/greendrake/cctv/muxer/ebml/core"
+	"github.com/greendrake/cctv/muxer/ebml/matroska"
+	"github.com/greendrake/cctv/muxer/ebml/mkvcore"
+	"github.com/greendrake/cctv/muxer/ebml/webm"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+type block struct {
+	video     bool
+	keyframe  bool
+	timestamp time.Duration // Relative to the chunk start
+	data      []byte
+}
+
+// readTracks reads the full track entries, which (unlike the ones given by mkvcore block readers)
+// include audio parameters.
+func readTracks(r io.Reader) ([]webm.TrackEntry, error) {
+	var header struct {
+		Segment struct {
+			Tracks struct {
+				TrackEntry []webm.TrackEntry
+			} `ebml:"Tracks,stop"`
+		}
+	}
+	if err := ebml.Unmarshal(r, &header); err != ebml.ErrReadStopped {
+		return nil, err
+	}
+	return header.Segment.Tracks.TrackEntry, nil
+}
+
+// readFileHeader reads the track entries and the tags (describing the source) of the MKV file
+func readFileHeader(path string) ([]webm.TrackEntry, []matroska.Tag, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	tracks, err := readTracks(f)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+	_, tags, err := matroska.ReadMetadata(f)
+	return tracks, tags, err
+}
+
+// readChunk calls fn for every block of the first video track and all audio tracks of the MKV file,
+// per track in timestamp order. Returning an error from fn stops reading and makes readChunk return that error.
+func readChunk(path string, fn func(b *block) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	readers, err := mkvcore.NewSimpleBlockReader(f, mkvcore.WithOnFatalHandler(func(err error) {}))
+	if err != nil {
+		return err
+	}
+	// The block reader feeds all tracks from a single goroutine, so they all have to be read concurrently
+	blocks := make(chan *block)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	videoSeen := false
+	for _, r := range readers {
+		t := r.TrackEntry().TrackType
+		isVideo := t == core.TrackTypeVideo && !videoSeen
+		if isVideo {
+			videoSeen = true
+		}
+		if !isVideo && t != core.TrackTypeAudio {
+			r.Close()
+			continue
+		}
+		wg.Add(1)
+		go func(r mkvcore.BlockReadCloserWithTrackEntry) {
+			defer wg.Done()
+			defer r.Close()
+			for {
+				b, keyframe, timestamp, err := r.Read()
+				if err != nil {
+					return
+				}
+				select {
+				case blocks <- &block{
+					video:     isVideo,
+					keyframe:  keyframe,
+					timestamp: time.Duration(timestamp) * time.Millisecond,
+					data:      b,
+				}:
+				case <-done:
+					return
+				}
+			}
+		}(r)
+	}
+	go func() {
+		wg.Wait()
+		close(blocks)
+	}()
+	defer close(done)
+	for b := range blocks {
+		if err = fn(b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -13,4 +13,21 @@ type Frame struct {
 	IsAudio         bool
 	Duration        time.Duration
 	Data            *[]byte
+	// Capture time by the camera's clock (video only). Zero unless the camera clock is used.
+	Time time.Time
+}
+
+const (
+	AudioCodecPCMA = "PCMA"
+	AudioCodecPCMU = "PCMU"
+	AudioCodecAAC  = "AAC"
+)
+
+// AudioFormat describes the audio of a stream
+type AudioFormat struct {
+	Codec      string
+	SampleRate int
+	Channels   int
+	// AudioSpecificConfig (AAC only)
+	Config []byte
 }
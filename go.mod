@@ -15,6 +15,7 @@ require (
 	github.com/greendrake/fractions v0.0.1
 	github.com/greendrake/server_client_hierarchy v0.0.0-20250612103916-732778f78656
 	github.com/pion/rtp v1.8.18
+	go.etcd.io/bbolt v1.4.0
 	golang.org/x/net v0.41.0
 	gopkg.in/yaml.v3 v3.0.1
 )
@@ -9,6 +9,7 @@ type Codec struct {
 }
 
 const (
+	CodecH264           = "H264"
 	CodecH265           = "H265"
 	PayloadTypeRAW byte = 255
 )
@@ -22,11 +22,17 @@ type WriteSeekCloser interface {
 }
 
 type Matroska struct {
-	w      *writerFileSize
-	tracks []Track
+	w       *writerFileSize
+	tracks  []Track
+	dateUTC time.Time
+	tags    []Tag
 }
 
 func Open(w WriteSeekCloser, tracks ...Track) (*Matroska, error) {
+	return OpenWithOptions(w, tracks)
+}
+
+func OpenWithOptions(w WriteSeekCloser, tracks []Track, opts ...Option[*Matroska]) (*Matroska, error) {
 	if len(tracks) == 0 {
 		return nil, ErrNoTracks
 	}
@@ -38,6 +44,10 @@ func Open(w WriteSeekCloser, tracks ...Track) (*Matroska, error) {
 		tracks: tracks,
 	}
 
+	for _, o := range opts {
+		o.Apply(m)
+	}
+
 	m.modifyTrackNumber()
 
 	if err := m.open(); err != nil {
@@ -114,11 +124,15 @@ func (m *Matroska) WriteAudio(timestamp time.Duration, b []byte) (int, error) {
 }
 
 func (m *Matroska) getOptions() []mkvcore.BlockWriterOption {
+	// Own copy per file, as the writer sets its duration and date
+	info := *mkv.DefaultSegmentInfo
+	info.DateUTC = m.dateUTC
+
 	var opts = []mkvcore.BlockWriterOption{
 		mkvcore.WithSeekHead(true),
 		mkvcore.WithCues(true),
 		mkvcore.WithEBMLHeader(mkv.DefaultEBMLHeader),
-		mkvcore.WithSegmentInfo(mkv.DefaultSegmentInfo),
+		mkvcore.WithSegmentInfo(&info),
 		mkvcore.WithOnErrorHandler(func(err error) {
 			panic(err)
 		}),
@@ -128,6 +142,10 @@ func (m *Matroska) getOptions() []mkvcore.BlockWriterOption {
 		//mkvcore.WithMarshalOptions(ebml.WithDataSizeLen(2)),
 	}
 
+	if len(m.tags) > 0 {
+		opts = append(opts, mkvcore.WithSimpleTags(toMKVTag(m.tags)))
+	}
+
 	if len(m.tracks) == 1 && m.tracks[0].IsAudio() {
 		// only audio
 		opts = append(opts, mkvcore.WithMaxKeyframeInterval(1, math.MaxInt16-5000))
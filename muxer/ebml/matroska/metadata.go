@@ -0,0 +1,76 @@
+package matroska
+
+import (
+	"io"
+	"time"
+
+	"github.com/greendrake/cctv/muxer/ebml"
+	"github.com/greendrake/cctv/muxer/ebml/mkv"
+	"github.com/greendrake/cctv/muxer/ebml/mkvcore"
+)
+
+// Tag is a global (whole file) Matroska SimpleTag
+type Tag struct {
+	Name  string
+	Value string
+}
+
+// WithDateUTC sets the wall-clock time of the start of the file (the time of the first frame).
+// The time of opening the file is used by default.
+func WithDateUTC(t time.Time) Option[*Matroska] {
+	return NewFuncOption(func(m *Matroska) {
+		m.dateUTC = t.Truncate(time.Millisecond)
+	})
+}
+
+// WithTags adds tags describing the file, e.g. its source
+func WithTags(tags ...Tag) Option[*Matroska] {
+	return NewFuncOption(func(m *Matroska) {
+		m.tags = append(m.tags, tags...)
+	})
+}
+
+func toMKVTag(tags []Tag) mkvcore.Tag {
+	t := mkvcore.Tag{
+		Targets: mkvcore.Targets{
+			TargetTypeValue: 50,
+			TargetType:      "MOVIE",
+		},
+	}
+	for _, tag := range tags {
+		t.SimpleTag = append(t.SimpleTag, mkvcore.SimpleTag{
+			TagName:   tag.Name,
+			TagString: tag.Value,
+		})
+	}
+	return t
+}
+
+// ReadMetadata reads DateUTC and the global tags from the file header
+func ReadMetadata(r io.Reader) (dateUTC time.Time, tags []Tag, err error) {
+	var header struct {
+		Segment struct {
+			Info mkv.Info
+			Tags []mkvcore.Tags
+			// The block writer puts Void right after the header; stop at the first cluster otherwise
+			Void    []byte   `ebml:"Void,stop"`
+			Cluster struct{} `ebml:"Cluster,stop"`
+		}
+	}
+	switch err = ebml.Unmarshal(r, &header); err {
+	case nil, ebml.ErrReadStopped:
+	default:
+		return time.Time{}, nil, err
+	}
+	for _, ts := range header.Segment.Tags {
+		for _, t := range ts.Tag {
+			if t.Targets.TargetTypeValue != 0 && t.Targets.TargetTypeValue != 50 {
+				continue
+			}
+			for _, st := range t.SimpleTag {
+				tags = append(tags, Tag{Name: st.TagName, Value: st.TagString})
+			}
+		}
+	}
+	return header.Segment.Info.DateUTC, tags, nil
+}
@@ -0,0 +1,252 @@
+package matroska
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"math/bits"
+	"os"
+
+	"github.com/greendrake/cctv/muxer/ebml"
+	"github.com/greendrake/cctv/muxer/ebml/mkvcore"
+)
+
+// ErrNoClusters means that a file has nothing to recover
+var ErrNoClusters = errors.New("no complete clusters")
+
+// Close() writes the Cues and patches the SeekHead (written with zero Cluster/Cues positions) and the Duration
+// in place. If Close() never ran (e.g. the process was killed), the Cues position stays zero, which is how
+// unfinalized files are recognised.
+
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+type seekEntry struct {
+	id     []byte
+	offset uint64 // of the SeekPosition value in the file
+	pos    uint64
+}
+
+type repairCluster struct {
+	position   uint64 // of the Cluster element in the file
+	size       uint64 // of its data
+	timestamp  uint64
+	blocks     int
+	firstTrack uint64
+	firstKey   bool
+	lastTc     int64
+}
+
+// IsFinalized tells whether the file was closed properly, by reading its SeekHead only
+func IsFinalized(r io.Reader) (bool, error) {
+	var header struct {
+		Segment struct {
+			SeekHead struct {
+				Seek []struct {
+					SeekID       []byte
+					SeekPosition uint64
+				}
+			} `ebml:"SeekHead,stop"`
+		}
+	}
+	switch err := ebml.Unmarshal(r, &header); err {
+	case ebml.ErrReadStopped:
+	case nil:
+		// No SeekHead at all: not written by this muxer, nothing to do about it
+		return true, nil
+	default:
+		return false, err
+	}
+	for _, s := range header.Segment.SeekHead.Seek {
+		if bytes.Equal(s.SeekID, ebml.ElementCues.Bytes()) {
+			return s.SeekPosition != 0, nil
+		}
+	}
+	return true, nil
+}
+
+// Repair finalizes the file if it was not closed properly: cuts off the incomplete trailing cluster,
+// and rebuilds the Cues, the Duration and the SeekHead from the complete clusters.
+// Returns false if the file did not need repairing.
+func Repair(path string) (bool, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	if ok, err := IsFinalized(bufio.NewReader(f)); err != nil || ok {
+		return false, err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+
+	var (
+		r          = &countingReader{r: bufio.NewReader(f)}
+		segmentPos uint64
+		seeks      []*seekEntry
+		seekID     []byte
+		durOffset  uint64
+		durSize    uint64
+		clusters   []*repairCluster
+		cur        = &repairCluster{}
+	)
+	hook := func(e *ebml.Element) {
+		switch e.Name {
+		case "SeekHead":
+			segmentPos = e.Position
+		case "SeekID":
+			seekID, _ = e.Value.([]byte)
+		case "SeekPosition":
+			seeks = append(seeks, &seekEntry{id: seekID, offset: r.n - e.Size})
+		case "Duration":
+			durOffset, durSize = r.n-e.Size, e.Size
+		case "Timestamp":
+			cur.timestamp, _ = e.Value.(uint64)
+		case "SimpleBlock":
+			b, ok := e.Value.(ebml.Block)
+			if !ok {
+				return
+			}
+			if cur.blocks == 0 {
+				cur.firstTrack, cur.firstKey = b.TrackNumber, b.Keyframe
+			}
+			cur.blocks++
+			if tc := int64(cur.timestamp) + int64(b.Timecode); tc > cur.lastTc {
+				cur.lastTc = tc
+			}
+		case "Cluster":
+			cur.position, cur.size = e.Position, e.Size
+			clusters = append(clusters, cur)
+			cur = &repairCluster{}
+		}
+	}
+	var file struct {
+		Segment struct {
+			SeekHead struct {
+				Seek []struct {
+					SeekID       []byte
+					SeekPosition uint64
+				}
+			}
+			Info struct {
+				Duration float64
+			}
+			Cluster struct {
+				Timestamp   uint64
+				SimpleBlock ebml.Block
+			}
+		}
+	}
+	// A truncated file ends with an error here, which is expected
+	_ = ebml.Unmarshal(r, &file, ebml.WithElementReadHooks(hook))
+	// The reader takes a cluster cut off within a block for a whole one, so check them against the file size
+	info, err := f.Stat()
+	if err != nil {
+		return false, err
+	}
+	var end uint64 // of the last complete cluster
+	for len(clusters) > 0 {
+		if end, err = clusterEnd(f, clusters[len(clusters)-1]); err != nil {
+			return false, err
+		}
+		if end <= uint64(info.Size()) {
+			break
+		}
+		clusters = clusters[:len(clusters)-1]
+	}
+	if len(clusters) == 0 {
+		return false, ErrNoClusters
+	}
+
+	// Same as written by the block writer: a cue point for every cluster starting with a keyframe
+	cues := struct {
+		Cues *mkvcore.Cues `ebml:"Cues"`
+	}{
+		Cues: &mkvcore.Cues{},
+	}
+	var lastTc int64
+	for _, c := range clusters {
+		if c.blocks > 0 && c.firstKey {
+			cues.Cues.CuePoint = append(cues.Cues.CuePoint, mkvcore.CuePoint{
+				CueTime: c.timestamp,
+				CueTrackPositions: []mkvcore.CueTrackPosition{
+					{
+						CueTrack:           c.firstTrack,
+						CueClusterPosition: c.position - segmentPos,
+						CueBlockNumber:     1,
+					},
+				},
+			})
+		}
+		if c.lastTc > lastTc {
+			lastTc = c.lastTc
+		}
+	}
+
+	if err := f.Truncate(int64(end)); err != nil {
+		return false, err
+	}
+	if _, err := f.Seek(int64(end), io.SeekStart); err != nil {
+		return false, err
+	}
+	if err := ebml.Marshal(&cues, f); err != nil {
+		return false, err
+	}
+
+	for _, s := range seeks {
+		switch {
+		case bytes.Equal(s.id, ebml.ElementCluster.Bytes()):
+			s.pos = clusters[0].position - segmentPos
+		case bytes.Equal(s.id, ebml.ElementCues.Bytes()):
+			s.pos = end - segmentPos
+		default:
+			continue
+		}
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], s.pos)
+		if _, err := f.WriteAt(b[:], int64(s.offset)); err != nil {
+			return false, err
+		}
+	}
+
+	if durOffset > 0 {
+		var b []byte
+		switch durSize {
+		case 4:
+			b = binary.BigEndian.AppendUint32(nil, math.Float32bits(float32(lastTc)))
+		case 8:
+			b = binary.BigEndian.AppendUint64(nil, math.Float64bits(float64(lastTc)))
+		}
+		if _, err := f.WriteAt(b, int64(durOffset)); err != nil {
+			return false, err
+		}
+	}
+
+	return true, f.Sync()
+}
+
+// clusterEnd tells where the cluster ends in the file, by the length of its header
+func clusterEnd(f io.ReaderAt, c *repairCluster) (uint64, error) {
+	// The 4-byte Cluster ID, then the data size, whose length is told by its first byte
+	var b [5]byte
+	if _, err := f.ReadAt(b[:], int64(c.position)); err != nil {
+		return 0, err
+	}
+	if b[4] == 0 {
+		return 0, errors.New("invalid cluster size")
+	}
+	return c.position + 4 + uint64(bits.LeadingZeros8(b[4])+1) + c.size, nil
+}
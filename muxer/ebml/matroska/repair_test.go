@@ -0,0 +1,171 @@
+package matroska
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/greendrake/cctv/muxer/ebml"
+)
+
+// memFile is a file in memory which keeps what was written before the first seek back,
+// i.e. the file as a crash would leave it, before Close() patches it
+type memFile struct {
+	buf     []byte
+	pos     int64
+	crashed []byte
+}
+
+func (f *memFile) Write(p []byte) (int, error) {
+	if end := f.pos + int64(len(p)); end > int64(len(f.buf)) {
+		f.buf = append(f.buf, make([]byte, end-int64(len(f.buf)))...)
+	}
+	copy(f.buf[f.pos:], p)
+	f.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (f *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += int64(len(f.buf))
+	}
+	if offset < f.pos && f.crashed == nil {
+		f.crashed = bytes.Clone(f.buf)
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func (f *memFile) Close() error {
+	return nil
+}
+
+// avcc makes an AVCC payload of the NAL units
+func avcc(nalus ...[]byte) []byte {
+	var b []byte
+	for _, n := range nalus {
+		b = append(b, byte(len(n)>>24), byte(len(n)>>16), byte(len(n)>>8), byte(len(n)))
+		b = append(b, n...)
+	}
+	return b
+}
+
+// writeCrashed writes seconds of 25 fps H.264 with a key frame every second (and so a cluster every second),
+// and returns the file as it was before finalizing
+func writeCrashed(t *testing.T, seconds int) []byte {
+	f := &memFile{}
+	mkv, err := Open(f, NewTrackH264())
+	if err != nil {
+		t.Fatal(err)
+	}
+	idr := avcc([]byte{0x65, 0x88, 0x80, 0x40}, []byte{0x09, 0xF0})
+	slice := avcc([]byte{0x41, 0x9A, 0x02, 0x03})
+	for i := 0; i < seconds*25; i++ {
+		frame := slice
+		if i%25 == 0 {
+			frame = idr
+		}
+		if _, err = mkv.WriteVideo(time.Duration(i)*40*time.Millisecond, frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mkv.Close()
+	if f.crashed == nil {
+		t.Fatal("The file was not patched on closing")
+	}
+	return f.crashed
+}
+
+// truncateInLastCluster cuts the file in the middle of its last cluster
+func truncateInLastCluster(t *testing.T, data []byte) []byte {
+	i := bytes.LastIndex(data, ebml.ElementCluster.Bytes())
+	if i < 0 {
+		t.Fatal("No cluster")
+	}
+	return data[:i+20]
+}
+
+func TestRepair(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crashed.mkv")
+	if err := os.WriteFile(path, truncateInLastCluster(t, writeCrashed(t, 4)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open(path)
+	finalized, err := IsFinalized(f)
+	f.Close()
+	if err != nil || finalized {
+		t.Fatalf("The crashed file must be unfinalized, got %v, %v", finalized, err)
+	}
+
+	repaired, err := Repair(path)
+	if err != nil || !repaired {
+		t.Fatalf("Expected the file repaired, got %v, %v", repaired, err)
+	}
+
+	var file struct {
+		Segment struct {
+			Info struct {
+				Duration float64
+			}
+			Cluster []struct {
+				Timestamp uint64
+			}
+			Cues struct {
+				CuePoint []struct {
+					CueTime uint64
+				}
+			}
+		}
+	}
+	data, _ := os.ReadFile(path)
+	if err = ebml.Unmarshal(bytes.NewReader(data), &file); err != nil {
+		t.Fatalf("The repaired file must parse: %v", err)
+	}
+	// The 4th cluster is incomplete and cut off
+	if n := len(file.Segment.Cluster); n != 3 {
+		t.Errorf("Expected 3 complete clusters, got %v", n)
+	}
+	var cueTimes []uint64
+	for _, c := range file.Segment.Cues.CuePoint {
+		cueTimes = append(cueTimes, c.CueTime)
+	}
+	if len(cueTimes) != 3 || cueTimes[0] != 0 || cueTimes[1] != 1000 || cueTimes[2] != 2000 {
+		t.Errorf("Expected a cue point at every cluster, got %v", cueTimes)
+	}
+	// Up to the last frame of the 3rd second
+	if d := file.Segment.Info.Duration; d < 2900 || d >= 3000 {
+		t.Errorf("Expected the duration up to the last complete cluster, got %v", d)
+	}
+
+	f, _ = os.Open(path)
+	finalized, err = IsFinalized(f)
+	f.Close()
+	if err != nil || !finalized {
+		t.Errorf("The repaired file must be finalized, got %v, %v", finalized, err)
+	}
+	if repaired, err = Repair(path); err != nil || repaired {
+		t.Errorf("A finalized file must be left alone, got %v, %v", repaired, err)
+	}
+}
+
+func TestRepairNoClusters(t *testing.T) {
+	data := writeCrashed(t, 1)
+	path := filepath.Join(t.TempDir(), "crashed.mkv")
+	if err := os.WriteFile(path, truncateInLastCluster(t, data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Repair(path); !errors.Is(err, ErrNoClusters) {
+		t.Errorf("Expected ErrNoClusters, got %v", err)
+	}
+	before, _ := os.ReadFile(path)
+	if !bytes.Equal(before, truncateInLastCluster(t, data)) {
+		t.Errorf("A file with nothing to recover must be left as is")
+	}
+}
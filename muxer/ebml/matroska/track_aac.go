@@ -11,7 +11,7 @@ type trackAAC struct {
 	UnimplementedTrack
 }
 
-func NewTrackAAC(samplingFrequency int, channels int) Track {
+func NewTrackAAC(samplingFrequency int, channels int, opts ...Option[*trackAAC]) Track {
 	t := &trackAAC{
 		UnimplementedTrack: UnimplementedTrack{
 			track: webm.TrackEntry{
@@ -28,9 +28,20 @@ func NewTrackAAC(samplingFrequency int, channels int) Track {
 		},
 	}
 
+	for _, opt := range opts {
+		opt.Apply(t)
+	}
+
 	return t
 }
 
+// WithAACConfig AudioSpecificConfig, required by players to decode the track
+func WithAACConfig(config []byte) Option[*trackAAC] {
+	return NewFuncOption(func(o *trackAAC) {
+		o.track.CodecPrivate = config
+	})
+}
+
 func (tis *trackAAC) Write(timestamp time.Duration, b []byte, keyframe ...bool) (int, error) {
 	return tis.UnimplementedTrack.Write(timestamp, b, true)
 }
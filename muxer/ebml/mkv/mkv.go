@@ -52,3 +52,7 @@ func (c *Info) SetDuration(duration float64) {
 func (c *Info) SetDateUTC(date time.Time) {
 	c.DateUTC = date
 }
+
+func (c *Info) GetDateUTC() time.Time {
+	return c.DateUTC
+}
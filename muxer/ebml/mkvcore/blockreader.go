@@ -100,6 +100,16 @@ func NewSimpleBlockReader(r io.Reader, opts ...BlockReaderOption) ([]BlockReadCl
 	}
 	blockCh := make(chan ebml.Block)
 	blockGroupCh := make(chan blockGroup)
+	// Cluster timestamps are passed in order with the blocks, as c.Cluster.Timecode may already be
+	// overwritten by the next cluster while the last block of the previous one is being dispatched.
+	timecodeCh := make(chan uint64)
+	timecodeHook := func(e *ebml.Element) {
+		if e.Type == ebml.ElementTimecode && e.Parent != nil && e.Parent.Type == ebml.ElementCluster {
+			if tc, ok := e.Value.(uint64); ok {
+				timecodeCh <- tc
+			}
+		}
+	}
 	c := struct {
 		Cluster clusterReader
 	}{
@@ -111,10 +121,13 @@ func NewSimpleBlockReader(r io.Reader, opts ...BlockReaderOption) ([]BlockReadCl
 	go func() {
 		blockCh := blockCh
 		blockGroupCh := blockGroupCh
+		var timecode uint64
 	L_READ:
 		for {
 			var b *ebml.Block
 			select {
+			case timecode = <-timecodeCh:
+				continue
 			case block, ok := <-blockCh:
 				if !ok {
 					blockCh = nil
@@ -142,7 +155,7 @@ func NewSimpleBlockReader(r io.Reader, opts ...BlockReaderOption) ([]BlockReadCl
 				frame := &frame{
 					trackNumber: b.TrackNumber,
 					keyframe:    b.Keyframe,
-					timestamp:   int64(c.Cluster.Timecode) + int64(b.Timecode),
+					timestamp:   int64(timecode) + int64(b.Timecode),
 					b:           b.Data[l],
 				}
 				select {
@@ -160,7 +173,9 @@ func NewSimpleBlockReader(r io.Reader, opts ...BlockReaderOption) ([]BlockReadCl
 			close(blockCh)
 			close(blockGroupCh)
 		}()
-		if err := ebml.Unmarshal(r, &c, options.unmarshalOpts...); err != nil {
+		// Copied not to append to the backing array of the caller's options
+		opts := append(append([]ebml.UnmarshalOption{}, options.unmarshalOpts...), ebml.WithElementReadHooks(timecodeHook))
+		if err := ebml.Unmarshal(r, &c, opts...); err != nil {
 			if options.onFatal != nil {
 				options.onFatal(err)
 			}
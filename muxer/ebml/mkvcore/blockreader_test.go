@@ -0,0 +1,95 @@
+package mkvcore
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/greendrake/cctv/muxer/ebml"
+)
+
+type testTrackEntry struct {
+	TrackNumber uint64
+	TrackUID    uint64
+	CodecID     string
+	TrackType   uint8
+}
+
+func (*testTrackEntry) SetAudioSamplingFrequency(float64) {}
+
+type bufferCloser struct {
+	bytes.Buffer
+}
+
+func (*bufferCloser) Close() error {
+	return nil
+}
+
+func TestSimpleBlockReaderClusterTimecodes(t *testing.T) {
+	buf := &bufferCloser{}
+	tracks := []TrackDescription{{TrackNumber: 1, TrackEntry: &testTrackEntry{TrackNumber: 1, TrackUID: 1, CodecID: "V_MPEG4/ISO/AVC", TrackType: 1}}}
+	// A new cluster at the first key frame past 1s into the cluster
+	ws, err := NewSimpleBlockWriter(buf, tracks, WithMaxKeyframeInterval(1, 0x7FFF-1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10 frames per second, a key frame every second
+	var timestamps []int64
+	for i := 0; i < 50; i++ {
+		ts := int64(i * 100)
+		if _, err := ws[0].Write(i%10 == 0, ts, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		timestamps = append(timestamps, ts)
+	}
+	ws[0].Close()
+
+	var file struct {
+		Segment struct {
+			Cluster []struct {
+				Timecode    uint64
+				SimpleBlock []ebml.Block
+			}
+		}
+	}
+	if err := ebml.Unmarshal(bytes.NewReader(buf.Bytes()), &file); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(file.Segment.Cluster); n < 3 {
+		t.Fatalf("Expected several clusters, got %v", n)
+	}
+
+	// Options of the caller, with room to append to
+	clusters := 0
+	opts := make([]ebml.UnmarshalOption, 1, 2)
+	opts[0] = ebml.WithElementReadHooks(func(e *ebml.Element) {
+		if e.Type == ebml.ElementCluster {
+			clusters++
+		}
+	})
+	rs, err := NewSimpleBlockReader(bytes.NewReader(buf.Bytes()), WithUnmarshalOptions(opts...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rs) != 1 {
+		t.Fatalf("Expected 1 track, got %v", len(rs))
+	}
+	for i, expected := range timestamps {
+		b, keyframe, ts, err := rs[0].Read()
+		if err != nil {
+			t.Fatalf("Frame %v: %v", i, err)
+		}
+		// The last block of a cluster must not get the timecode of the next one
+		if ts != expected || keyframe != (i%10 == 0) || b[0] != byte(i) {
+			t.Errorf("Frame %v: expected %v at %v (key frame %v), got %v at %v (key frame %v)", i, i, expected, i%10 == 0, b[0], ts, keyframe)
+		}
+	}
+	if _, _, _, err := rs[0].Read(); err == nil {
+		t.Error("Expected the end of the track")
+	}
+	if opts[:2][1] != nil {
+		t.Error("Expected the options of the caller untouched")
+	}
+	if clusters != len(file.Segment.Cluster) {
+		t.Errorf("Expected the hook of the caller to see %v clusters, got %v", len(file.Segment.Cluster), clusters)
+	}
+}
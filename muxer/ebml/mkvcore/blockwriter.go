@@ -200,7 +200,10 @@ func writeHeader(w *writerWithSizeCount, tracks []TrackDescription, options *Blo
 				info.SetDuration(*fileDuration)
 			} else {
 				info.SetDuration(5)
-				info.SetDateUTC(time.Now().Truncate(time.Millisecond))
+				// Keep the date if given by the caller (e.g. the time of the first frame)
+				if d, ok := header.Segment.Info.(interface{ GetDateUTC() time.Time }); !ok || d.GetDateUTC().IsZero() {
+					info.SetDateUTC(time.Now().Truncate(time.Millisecond))
+				}
 			}
 		}
 
@@ -302,9 +302,10 @@ type UnmarshalOptions struct {
 }
 
 // WithElementReadHooks returns an UnmarshalOption which registers element hooks.
+// The hooks add up over multiple options.
 func WithElementReadHooks(hooks ...func(*Element)) UnmarshalOption {
 	return func(opts *UnmarshalOptions) error {
-		opts.hooks = hooks
+		opts.hooks = append(opts.hooks, hooks...)
 		return nil
 	}
 }
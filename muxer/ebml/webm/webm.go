@@ -74,6 +74,10 @@ func (c *Info) SetDateUTC(date time.Time) {
 	c.DateUTC = date
 }
 
+func (c *Info) GetDateUTC() time.Time {
+	return c.DateUTC
+}
+
 // TrackEntry represents TrackEntry element struct.
 type TrackEntry struct {
 	Name            string         `ebml:"Name,omitempty"`
@@ -0,0 +1,106 @@
+package h264
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+
+	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
+)
+
+const (
+	NALUTypePFrame = 1
+	NALUTypeIFrame = 5
+	NALUTypeSEI    = 6
+	NALUTypeSPS    = 7
+	NALUTypePPS    = 8
+	NALUTypeAUD    = 9
+)
+
+// NALUType of the first NALU of an AVCC payload, or 0 if it is too short
+func NALUType(b []byte) byte {
+	if len(b) < 5 {
+		return 0
+	}
+	return b[4] & 0x1F
+}
+
+func IsKeyframe(b []byte) bool {
+	for {
+		if len(b) < 5 {
+			return false
+		}
+		switch NALUType(b) {
+		case NALUTypePFrame:
+			return false
+		case NALUTypeIFrame:
+			return true
+		}
+
+		size := int(binary.BigEndian.Uint32(b)) + 4
+		if size < len(b) {
+			b = b[size:]
+			continue
+		} else {
+			return false
+		}
+	}
+}
+
+func GetParameterSet(fmtp string) (sps, pps []byte) {
+	if fmtp == "" {
+		return
+	}
+
+	i := strings.Index(fmtp, "sprop-parameter-sets=")
+	if i < 0 {
+		return
+	}
+	s := fmtp[i+len("sprop-parameter-sets="):]
+	if i = strings.IndexByte(s, ';'); i >= 0 {
+		s = s[:i]
+	}
+
+	sets := strings.Split(s, ",")
+	sps, _ = base64.StdEncoding.DecodeString(sets[0])
+	if len(sets) > 1 {
+		pps, _ = base64.StdEncoding.DecodeString(sets[1])
+	}
+
+	return
+}
+
+// EncodeConfig makes AVCDecoderConfigurationRecord (ISO/IEC 14496-15, 5.2.4.1)
+func EncodeConfig(sps, pps []byte) ([]byte, error) {
+	if len(sps) < 4 {
+		return nil, fmt.Errorf("H.264 SPS too short: %v bytes", len(sps))
+	}
+	spsSize := uint16(len(sps))
+	ppsSize := uint16(len(pps))
+
+	buf := make([]byte, 5+3+spsSize+3+ppsSize)
+
+	buf[0] = 1
+	copy(buf[1:], sps[1:4]) // profile, compatibility, level
+	buf[4] = 3 | 0xFC       // 4 bytes length
+	buf[5] = 1 | 0xE0       // SPS count
+	binary.BigEndian.PutUint16(buf[6:], spsSize)
+	copy(buf[8:], sps)
+
+	b := buf[8+spsSize:]
+	b[0] = 1 // PPS count
+	binary.BigEndian.PutUint16(b[1:], ppsSize)
+	copy(b[3:], pps)
+
+	return buf, nil
+}
+
+// SPSSize returns the picture size from the SPS, or false if it cannot be parsed
+func SPSSize(sps []byte) (width, height uint16, ok bool) {
+	var s h264.SPS
+	if err := s.Unmarshal(sps); err != nil {
+		return 0, 0, false
+	}
+	return uint16(s.Width()), uint16(s.Height()), true
+}
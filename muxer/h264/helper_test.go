@@ -0,0 +1,29 @@
+package h264
+
+import "testing"
+
+func TestIsKeyframe(t *testing.T) {
+	tests := []struct {
+		name     string
+		b        []byte
+		naluType byte
+		keyframe bool
+	}{
+		{"empty", nil, 0, false},
+		{"length only", []byte{0, 0, 0, 1}, 0, false},
+		{"I-frame", []byte{0, 0, 0, 2, 0x65, 0x88}, NALUTypeIFrame, true},
+		{"P-frame", []byte{0, 0, 0, 2, 0x41, 0x9A}, NALUTypePFrame, false},
+		{"SPS then I-frame", []byte{0, 0, 0, 2, 0x67, 0x42, 0, 0, 0, 2, 0x65, 0x88}, NALUTypeSPS, true},
+		{"SPS then truncated", []byte{0, 0, 0, 2, 0x67, 0x42, 0, 0, 0}, NALUTypeSPS, false},
+		{"SPS then length only", []byte{0, 0, 0, 2, 0x67, 0x42, 0, 0, 0, 2}, NALUTypeSPS, false},
+		{"length past the end", []byte{0, 0, 0, 0x10, 0x67, 0x42}, NALUTypeSPS, false},
+	}
+	for _, test := range tests {
+		if naluType := NALUType(test.b); naluType != test.naluType {
+			t.Errorf("%v: expected NALU type %v, got %v", test.name, test.naluType, naluType)
+		}
+		if keyframe := IsKeyframe(test.b); keyframe != test.keyframe {
+			t.Errorf("%v: expected keyframe %v, got %v", test.name, test.keyframe, keyframe)
+		}
+	}
+}
@@ -36,11 +36,17 @@ func Between(s, sub1, sub2 string) string {
 }
 
 func NALUType(b []byte) byte {
+	if len(b) < 5 {
+		return 0
+	}
 	return (b[4] >> 1) & 0x3F
 }
 
 func IsKeyframe(b []byte) bool {
 	for {
+		if len(b) < 5 {
+			return false
+		}
 		switch NALUType(b) {
 		case NALUTypePFrame:
 			return false
@@ -281,3 +287,18 @@ func (s *SPS) profile_tier_level(r *bits.Reader) bool {
 
 	return true
 }
+
+// EncodeToAnnexB is the reverse of EncodeToAVCC: it replaces NALU length prefixes with start codes
+func EncodeToAnnexB(avc []byte) (annexb []byte) {
+	annexb = make([]byte, 0, len(avc))
+	for len(avc) > 4 {
+		size := 4 + int(binary.BigEndian.Uint32(avc))
+		if size > len(avc) {
+			size = len(avc)
+		}
+		annexb = append(annexb, 0, 0, 0, 1)
+		annexb = append(annexb, avc[4:size]...)
+		avc = avc[size:]
+	}
+	return
+}
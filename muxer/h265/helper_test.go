@@ -0,0 +1,29 @@
+package h265
+
+import "testing"
+
+func TestIsKeyframe(t *testing.T) {
+	tests := []struct {
+		name     string
+		b        []byte
+		naluType byte
+		keyframe bool
+	}{
+		{"empty", nil, 0, false},
+		{"length only", []byte{0, 0, 0, 1}, 0, false},
+		{"IDR", []byte{0, 0, 0, 3, 0x26, 0x01, 0xAF}, NALUTypeIFrame, true},
+		{"P-frame", []byte{0, 0, 0, 3, 0x02, 0x01, 0xD0}, NALUTypePFrame, false},
+		{"VPS then IDR", []byte{0, 0, 0, 2, 0x40, 0x01, 0, 0, 0, 3, 0x26, 0x01, 0xAF}, NALUTypeVPS, true},
+		{"VPS then truncated", []byte{0, 0, 0, 2, 0x40, 0x01, 0, 0, 0}, NALUTypeVPS, false},
+		{"VPS then length only", []byte{0, 0, 0, 2, 0x40, 0x01, 0, 0, 0, 2}, NALUTypeVPS, false},
+		{"length past the end", []byte{0, 0, 0, 0x10, 0x40, 0x01}, NALUTypeVPS, false},
+	}
+	for _, test := range tests {
+		if naluType := NALUType(test.b); naluType != test.naluType {
+			t.Errorf("%v: expected NALU type %v, got %v", test.name, test.naluType, naluType)
+		}
+		if keyframe := IsKeyframe(test.b); keyframe != test.keyframe {
+			t.Errorf("%v: expected keyframe %v, got %v", test.name, test.keyframe, keyframe)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/binary"
 	"github.com/greendrake/cctv/muxer/core"
 	"math"
+	"time"
 )
 
 type Movie struct {
@@ -94,6 +95,8 @@ func (m *Movie) WriteMatrix() {
 func (m *Movie) WriteVideo(codec string, width, height uint16, conf []byte) {
 	// https://developer.apple.com/library/archive/documentation/QuickTime/QTFF/QTFFChap3/qtff3.html
 	switch codec {
+	case core.CodecH264:
+		m.StartAtom("avc1")
 	case core.CodecH265:
 		m.StartAtom("hev1")
 	default:
@@ -117,6 +120,8 @@ func (m *Movie) WriteVideo(codec string, width, height uint16, conf []byte) {
 	m.WriteUint16(0xFFFF) // color table id (-1)
 
 	switch codec {
+	case core.CodecH264:
+		m.StartAtom("avcC")
 	case core.CodecH265:
 		m.StartAtom("hvcC")
 	}
@@ -154,6 +159,9 @@ const (
 	MoovTrakMdiaMinfStblStco    = "stco"
 	MoovMvex                    = "mvex"
 	MoovMvexTrex                = "trex"
+	MoovUdta                    = "udta"
+	MoovUdtaMeta                = "meta"
+	MoovUdtaMetaIlst            = "ilst"
 	Moof                        = "moof"
 	MoofMfhd                    = "mfhd"
 	MoofTraf                    = "traf"
@@ -183,12 +191,18 @@ func (m *Movie) WriteFileType() {
 	m.EndAtom()
 }
 
-func (m *Movie) WriteMovieHeader() {
+// WriteMovieHeader writes the movie header, with the creation time unless it is zero
+func (m *Movie) WriteMovieHeader(created time.Time) {
 	m.StartAtom(MoovMvhd)
-	m.Skip(1)           // version
-	m.Skip(3)           // flags
-	m.Skip(4)           // create time
-	m.Skip(4)           // modify time
+	m.Skip(1) // version
+	m.Skip(3) // flags
+	if created.IsZero() {
+		m.Skip(4) // create time
+		m.Skip(4) // modify time
+	} else {
+		m.WriteUint32(macTime(created)) // create time
+		m.WriteUint32(macTime(created)) // modify time
+	}
 	m.WriteUint32(1000) // time scale
 	m.Skip(4)           // duration
 	m.WriteFloat32(1)   // preferred rate
@@ -200,6 +214,66 @@ func (m *Movie) WriteMovieHeader() {
 	m.EndAtom()
 }
 
+// macTime is the time in seconds since 1904-01-01 UTC, as in the headers
+func macTime(t time.Time) uint32 {
+	return uint32(t.Unix() + 2082844800)
+}
+
+// StartMetadata starts the user data the way iTunes writes it (moov/udta/meta/ilst), with the date as the ©day item.
+// Tags go in between it and EndMetadata.
+func (m *Movie) StartMetadata(date time.Time) {
+	m.StartAtom(MoovUdta)
+	m.StartAtom(MoovUdtaMeta)
+	m.Skip(1) // version
+	m.Skip(3) // flags
+
+	m.StartAtom(MoovTrakMdiaHdlr)
+	m.Skip(1)             // version
+	m.Skip(3)             // flags
+	m.Skip(4)             // predefined
+	m.WriteString("mdir") // handler type
+	m.WriteString("appl") // reserved, as iTunes writes it
+	m.Skip(2 * 4)         // reserved
+	m.Skip(1)             // name (empty string)
+	m.EndAtom()
+
+	m.StartAtom(MoovUdtaMetaIlst)
+	if !date.IsZero() {
+		m.StartAtom("\xa9day")
+		m.writeMetadataValue(date.UTC().Format(time.RFC3339))
+		m.EndAtom()
+	}
+}
+
+// WriteMetadataTag writes the tag as a free-form (----) item, which players and ffprobe list by its name
+func (m *Movie) WriteMetadataTag(name, value string) {
+	m.StartAtom("----")
+	m.StartAtom("mean")
+	m.Skip(4) // version and flags
+	m.WriteString("com.apple.iTunes")
+	m.EndAtom()
+	m.StartAtom("name")
+	m.Skip(4) // version and flags
+	m.WriteString(name)
+	m.EndAtom()
+	m.writeMetadataValue(value)
+	m.EndAtom()
+}
+
+func (m *Movie) EndMetadata() {
+	m.EndAtom() // ILST
+	m.EndAtom() // META
+	m.EndAtom() // UDTA
+}
+
+func (m *Movie) writeMetadataValue(s string) {
+	m.StartAtom("data")
+	m.WriteUint32(1) // type (UTF-8)
+	m.Skip(4)        // locale
+	m.WriteString(s)
+	m.EndAtom()
+}
+
 func (m *Movie) WriteTrackHeader(id uint32, width, height uint16) {
 	const (
 		TkhdTrackEnabled   = 0x0001
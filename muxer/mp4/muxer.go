@@ -3,12 +3,25 @@ package mp4
 import (
 	"encoding/base64"
 	"encoding/binary"
+	"fmt"
 	"github.com/greendrake/cctv/muxer/core"
+	"github.com/greendrake/cctv/muxer/h264"
 	"github.com/greendrake/cctv/muxer/h265"
 	"github.com/greendrake/cctv/muxer/iso"
+	"time"
 )
 
+// Tag describes the file, e.g. its source
+type Tag struct {
+	Name  string
+	Value string
+}
+
 type Muxer struct {
+	// Optional metadata written into the init segment: the wall-clock time the file starts at, and tags
+	CreationTime time.Time
+	Tags         []Tag
+
 	index  uint32
 	dts    []uint64
 	pts    []uint32
@@ -21,7 +34,12 @@ func (m *Muxer) AddTrack(codec *core.Codec) {
 	m.codecs = append(m.codecs, codec)
 }
 
-func (m *Muxer) GetInit(payload []byte, ClockRate uint32) []byte {
+// GetInit makes the init segment for a single video track (H264 or H265) out of the AVCC payload of a key frame,
+// which must carry the parameter sets.
+func (m *Muxer) GetInit(codecName string, payload []byte, ClockRate uint32) ([]byte, error) {
+	if codecName == core.CodecH264 {
+		return m.getInitH264(payload, ClockRate)
+	}
 	codec := &core.Codec{
 		Name:        core.CodecH265,
 		ClockRate:   ClockRate,
@@ -48,7 +66,42 @@ func (m *Muxer) GetInit(payload []byte, ClockRate uint32) []byte {
 	return m.getInit()
 }
 
-func (m *Muxer) getInit() []byte {
+func (m *Muxer) getInitH264(payload []byte, ClockRate uint32) ([]byte, error) {
+	codec := &core.Codec{
+		Name:        core.CodecH264,
+		ClockRate:   ClockRate,
+		PayloadType: core.PayloadTypeRAW,
+		FmtpLine:    "packetization-mode=1",
+	}
+	var sps, pps string
+	for {
+		if len(payload) < 5 {
+			break
+		}
+		size := 4 + int(binary.BigEndian.Uint32(payload))
+		if size > len(payload) {
+			return nil, fmt.Errorf("truncated H.264 NAL unit: %v of %v bytes", len(payload), size)
+		}
+		switch h264.NALUType(payload) {
+		case h264.NALUTypeSPS:
+			sps = base64.StdEncoding.EncodeToString(payload[4:size])
+		case h264.NALUTypePPS:
+			pps = base64.StdEncoding.EncodeToString(payload[4:size])
+		}
+		if size < len(payload) {
+			payload = payload[size:]
+		} else {
+			break
+		}
+	}
+	if sps != "" && pps != "" {
+		codec.FmtpLine += ";sprop-parameter-sets=" + sps + "," + pps
+	}
+	m.AddTrack(codec)
+	return m.getInit()
+}
+
+func (m *Muxer) getInit() ([]byte, error) {
 
 	// tracerr.PrintSourceColor(readNonExistent())
 
@@ -56,10 +109,33 @@ func (m *Muxer) getInit() []byte {
 	mv.WriteFileType()
 
 	mv.StartAtom(iso.Moov)
-	mv.WriteMovieHeader()
+	mv.WriteMovieHeader(m.CreationTime)
 
 	for i, codec := range m.codecs {
 		switch codec.Name {
+		case core.CodecH264:
+			sps, pps := h264.GetParameterSet(codec.FmtpLine)
+			// some dummy SPS and PPS not a problem
+			if len(sps) == 0 {
+				sps = []byte{0x67, 0x42, 0xc0, 0x28, 0xd9, 0x00, 0x78, 0x02, 0x27, 0xe5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xf0, 0x3c, 0x60, 0xc9, 0x20}
+			}
+			if len(pps) == 0 {
+				pps = []byte{0x68, 0xcb, 0x83, 0xcb, 0x20}
+			}
+
+			width, height, ok := h264.SPSSize(sps)
+			if !ok {
+				width = 1920
+				height = 1080
+			}
+
+			config, err := h264.EncodeConfig(sps, pps)
+			if err != nil {
+				return nil, err
+			}
+			mv.WriteVideoTrack(
+				uint32(i+1), codec.Name, codec.ClockRate, width, height, config,
+			)
 		case core.CodecH265:
 			vps, sps, pps := h265.GetParameterSet(codec.FmtpLine)
 			// some dummy SPS and PPS not a problem
@@ -94,15 +170,27 @@ func (m *Muxer) getInit() []byte {
 	}
 	mv.EndAtom() // MVEX
 
+	if !m.CreationTime.IsZero() || len(m.Tags) > 0 {
+		mv.StartMetadata(m.CreationTime)
+		for _, t := range m.Tags {
+			mv.WriteMetadataTag(t.Name, t.Value)
+		}
+		mv.EndMetadata()
+	}
+
 	mv.EndAtom() // MOOV
 
-	return mv.Bytes()
+	return mv.Bytes(), nil
 }
 
 func (m *Muxer) GetPayload(trackID byte, payload *[]byte, duration uint32) []byte {
 	m.index++
 	var flags uint32
-	if h265.IsKeyframe(*payload) {
+	isKeyframe := h265.IsKeyframe
+	if m.codecs[trackID].Name == core.CodecH264 {
+		isKeyframe = h264.IsKeyframe
+	}
+	if isKeyframe(*payload) {
 		flags = iso.SampleVideoIFrame
 	} else {
 		flags = iso.SampleVideoNonIFrame
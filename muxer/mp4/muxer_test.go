@@ -0,0 +1,79 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+
+	"github.com/greendrake/cctv/muxer/core"
+)
+
+// findBox returns the payload of the box at the path (e.g. moov, mvhd), or nil
+func findBox(b []byte, path ...string) []byte {
+	for len(b) >= 8 {
+		size := int(binary.BigEndian.Uint32(b))
+		if size < 8 || size > len(b) {
+			return nil
+		}
+		if string(b[4:8]) == path[0] {
+			if len(path) == 1 {
+				return b[8:size]
+			}
+			payload := b[8:size]
+			if path[0] == "meta" {
+				// Version and flags come before the children
+				payload = payload[4:]
+			}
+			return findBox(payload, path[1:]...)
+		}
+		b = b[size:]
+	}
+	return nil
+}
+
+func TestGetInitMetadata(t *testing.T) {
+	// SPS (1280x720 High profile) and PPS, then an IDR slice, in AVCC
+	var payload []byte
+	for _, nalu := range [][]byte{
+		{0x67, 0x64, 0x00, 0x1f, 0xac, 0xd9, 0x40, 0x50, 0x05, 0xbb, 0x01, 0x10, 0x00, 0x00, 0x03, 0x00, 0x10, 0x00, 0x00, 0x03, 0x03, 0xc0, 0xf1, 0x83, 0x19, 0x60},
+		{0x68, 0xeb, 0xe3, 0xcb, 0x22, 0xc0},
+		{0x65, 0x88, 0x84, 0x00},
+	} {
+		payload = binary.BigEndian.AppendUint32(payload, uint32(len(nalu)))
+		payload = append(payload, nalu...)
+	}
+	created := time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+	m := &Muxer{CreationTime: created, Tags: []Tag{{"CAMERA", "Front door"}, {"STREAM", "0"}}}
+	init, err := m.GetInit(core.CodecH264, payload, 90000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mvhd := findBox(init, "moov", "mvhd")
+	if len(mvhd) < 12 {
+		t.Fatal("No mvhd")
+	}
+	if seconds := binary.BigEndian.Uint32(mvhd[4:]); int64(seconds) != created.Unix()+2082844800 {
+		t.Errorf("Expected the creation time %v, got %v seconds since 1904", created, seconds)
+	}
+	ilst := findBox(init, "moov", "udta", "meta", "ilst")
+	if ilst == nil {
+		t.Fatal("No ilst")
+	}
+	for _, s := range []string{"\xa9day", "2026-03-01T12:30:00Z", "com.apple.iTunes", "CAMERA", "Front door", "STREAM"} {
+		if !bytes.Contains(ilst, []byte(s)) {
+			t.Errorf("Expected %q in the metadata", s)
+		}
+	}
+	// No metadata unless given
+	init, err = (&Muxer{}).GetInit(core.CodecH264, payload, 90000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if findBox(init, "moov", "udta") != nil {
+		t.Error("Expected no udta")
+	}
+	if mvhd := findBox(init, "moov", "mvhd"); binary.BigEndian.Uint32(mvhd[4:]) != 0 {
+		t.Error("Expected no creation time")
+	}
+}
@@ -0,0 +1,255 @@
+// Package onvif talks to ONVIF cameras: finds out their media profiles and the RTSP URIs of their streams
+package onvif
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/greendrake/cctv/util"
+)
+
+const (
+	nsSOAP   = "http://www.w3.org/2003/05/soap-envelope"
+	nsDevice = "http://www.onvif.org/ver10/device/wsdl"
+	nsMedia  = "http://www.onvif.org/ver10/media/wsdl"
+	nsSchema = "http://www.onvif.org/ver10/schema"
+	nsWSSE   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-secext-1.0.xsd"
+	nsWSU    = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-wssecurity-utility-1.0.xsd"
+
+	passwordDigest = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-username-token-profile-1.0#PasswordDigest"
+	base64Binary   = "http://docs.oasis-open.org/wss/2004/01/oasis-200401-wss-soap-message-security-1.0#Base64Binary"
+
+	requestTimeout = 10 * time.Second
+)
+
+// DefaultPath is where the device service of most cameras is
+const DefaultPath = "/onvif/device_service"
+
+// ErrNoService means the device does not offer the service, as per its capabilities
+var ErrNoService = errors.New("service not supported")
+
+// Client calls the services of an ONVIF device, authenticating with WS-UsernameToken. It is safe for concurrent use.
+type Client struct {
+	// URL of the device service, e.g. http://192.168.1.10/onvif/device_service
+	URL      string
+	User     string
+	Password string
+	HTTP     *http.Client
+
+	mutex sync.Mutex
+	// The password digest has to be created by the device clock, which may well be off
+	clockOffset time.Duration
+	clockKnown  bool
+	// URLs of the services of the device
+	capabilitiesKnown bool
+	mediaURL          string
+	eventsURL         string
+}
+
+func NewClient(url string, user string, password string) *Client {
+	return &Client{
+		URL:      url,
+		User:     user,
+		Password: password,
+		HTTP:     &http.Client{},
+	}
+}
+
+// Fault is an error reported by the device
+type Fault struct {
+	Code    string
+	Subcode string
+	Reason  string
+}
+
+func (f *Fault) Error() string {
+	s := "ONVIF fault " + f.Code
+	if f.Subcode != "" {
+		s += "/" + f.Subcode
+	}
+	if f.Reason != "" {
+		s += ": " + f.Reason
+	}
+	return s
+}
+
+// call posts the SOAP request with the body (XML) to the service, and decodes the response envelope into v
+func (c *Client) call(ctx context.Context, url string, body string, auth bool, v interface{}) error {
+	return c.callWithHeader(ctx, url, "", body, auth, v)
+}
+
+// callWithHeader is call with more in the SOAP header than the authentication, e.g. WS-Addressing
+func (c *Client) callWithHeader(ctx context.Context, url string, header string, body string, auth bool, v interface{}) error {
+	var envelope bytes.Buffer
+	envelope.WriteString(`<?xml version="1.0" encoding="UTF-8"?><s:Envelope xmlns:s="` + nsSOAP + `">`)
+	if auth && c.User != "" {
+		header = c.usernameToken() + header
+	}
+	if header != "" {
+		envelope.WriteString(`<s:Header>` + header + `</s:Header>`)
+	}
+	envelope.WriteString(`<s:Body>` + body + `</s:Body></s:Envelope>`)
+	// Pulling events takes as long as the caller says, anything else should be quick
+	if _, ok := ctx.Deadline(); !ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, requestTimeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, &envelope)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/soap+xml; charset=utf-8")
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 4<<20))
+	if err != nil {
+		return err
+	}
+	var fault struct {
+		Fault *struct {
+			Code    string `xml:"Code>Value"`
+			Subcode string `xml:"Code>Subcode>Value"`
+			Reason  string `xml:"Reason>Text"`
+		} `xml:"Body>Fault"`
+	}
+	xml.Unmarshal(data, &fault)
+	if f := fault.Fault; f != nil {
+		if strings.HasSuffix(f.Subcode, "NotAuthorized") || strings.HasSuffix(f.Subcode, "FailedAuthentication") {
+			return &util.WrongCredentialsError{Msg: "ONVIF: " + f.Reason}
+		}
+		return &Fault{Code: f.Code, Subcode: f.Subcode, Reason: f.Reason}
+	}
+	if resp.StatusCode == http.StatusUnauthorized {
+		return &util.WrongCredentialsError{Msg: "ONVIF: " + resp.Status}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("ONVIF request to %v failed: %v", url, resp.Status)
+	}
+	return xml.Unmarshal(data, v)
+}
+
+// usernameToken makes the WS-Security header with the password digest: Base64(SHA-1(nonce + created + password))
+func (c *Client) usernameToken() string {
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	c.mutex.Lock()
+	created := time.Now().Add(c.clockOffset).UTC().Format("2006-01-02T15:04:05.000Z")
+	c.mutex.Unlock()
+	h := sha1.New()
+	h.Write(nonce)
+	h.Write([]byte(created))
+	h.Write([]byte(c.Password))
+	return `<Security s:mustUnderstand="1" xmlns="` + nsWSSE + `"><UsernameToken>` +
+		`<Username>` + escape(c.User) + `</Username>` +
+		`<Password Type="` + passwordDigest + `">` + base64.StdEncoding.EncodeToString(h.Sum(nil)) + `</Password>` +
+		`<Nonce EncodingType="` + base64Binary + `">` + base64.StdEncoding.EncodeToString(nonce) + `</Nonce>` +
+		`<Created xmlns="` + nsWSU + `">` + created + `</Created>` +
+		`</UsernameToken></Security>`
+}
+
+func escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// syncClock learns how far the device clock is off, unless known already. Failing that, the host clock is used.
+func (c *Client) syncClock(ctx context.Context) {
+	c.mutex.Lock()
+	known := c.clockKnown
+	c.mutex.Unlock()
+	if known {
+		return
+	}
+	var resp struct {
+		UTC struct {
+			Year   int `xml:"Date>Year"`
+			Month  int `xml:"Date>Month"`
+			Day    int `xml:"Date>Day"`
+			Hour   int `xml:"Time>Hour"`
+			Minute int `xml:"Time>Minute"`
+			Second int `xml:"Time>Second"`
+		} `xml:"Body>GetSystemDateAndTimeResponse>SystemDateAndTime>UTCDateTime"`
+	}
+	// Asked without authentication, as the device needs the time to check it
+	if err := c.call(ctx, c.URL, `<GetSystemDateAndTime xmlns="`+nsDevice+`"/>`, false, &resp); err != nil {
+		return
+	}
+	u := resp.UTC
+	if u.Year == 0 {
+		return
+	}
+	deviceTime := time.Date(u.Year, time.Month(u.Month), u.Day, u.Hour, u.Minute, u.Second, 0, time.UTC)
+	c.mutex.Lock()
+	c.clockOffset = deviceTime.Sub(time.Now())
+	c.clockKnown = true
+	c.mutex.Unlock()
+}
+
+// MediaURL returns the URL of the media service of the device
+func (c *Client) MediaURL(ctx context.Context) (string, error) {
+	if err := c.getCapabilities(ctx); err != nil {
+		return "", err
+	}
+	c.mutex.Lock()
+	u := c.mediaURL
+	c.mutex.Unlock()
+	if u == "" {
+		return "", fmt.Errorf("%w: ONVIF device %v has no media service", ErrNoService, c.URL)
+	}
+	return u, nil
+}
+
+// EventsURL returns the URL of the event service of the device
+func (c *Client) EventsURL(ctx context.Context) (string, error) {
+	if err := c.getCapabilities(ctx); err != nil {
+		return "", err
+	}
+	c.mutex.Lock()
+	u := c.eventsURL
+	c.mutex.Unlock()
+	if u == "" {
+		return "", fmt.Errorf("%w: ONVIF device %v has no event service", ErrNoService, c.URL)
+	}
+	return u, nil
+}
+
+// getCapabilities learns the URLs of the services of the device, unless known already
+func (c *Client) getCapabilities(ctx context.Context) error {
+	c.mutex.Lock()
+	known := c.capabilitiesKnown
+	c.mutex.Unlock()
+	if known {
+		return nil
+	}
+	c.syncClock(ctx)
+	var resp struct {
+		Media  string `xml:"Body>GetCapabilitiesResponse>Capabilities>Media>XAddr"`
+		Events string `xml:"Body>GetCapabilitiesResponse>Capabilities>Events>XAddr"`
+	}
+	body := `<GetCapabilities xmlns="` + nsDevice + `"><Category>All</Category></GetCapabilities>`
+	if err := c.call(ctx, c.URL, body, true, &resp); err != nil {
+		return err
+	}
+	c.mutex.Lock()
+	c.mediaURL = strings.TrimSpace(resp.Media)
+	c.eventsURL = strings.TrimSpace(resp.Events)
+	c.capabilitiesKnown = true
+	c.mutex.Unlock()
+	return nil
+}
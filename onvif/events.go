@@ -0,0 +1,198 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greendrake/cctv/event"
+)
+
+const (
+	nsEvents     = "http://www.onvif.org/ver10/events/wsdl"
+	nsNotify     = "http://docs.oasis-open.org/wsn/b-2"
+	nsAddressing = "http://www.w3.org/2005/08/addressing"
+)
+
+// Subscription is a PullPoint subscription to the events of the device
+type Subscription struct {
+	client *Client
+	// Where to pull the messages from
+	address string
+	// To be sent back with every request, e.g. the ID of the subscription
+	referenceParameters string
+}
+
+// Notification is an event message of the device
+type Notification struct {
+	// e.g. "tns1:RuleEngine/CellMotionDetector/Motion"
+	Topic string
+	// By the device clock
+	Time time.Time
+	// Initialized (the state at the time of subscription), Changed or Deleted
+	Operation string
+	// What the event is about (e.g. the video source and the rule) and its state (e.g. IsMotion: true)
+	Source map[string]string
+	Data   map[string]string
+}
+
+type simpleItems []struct {
+	Name  string `xml:"Name,attr"`
+	Value string `xml:"Value,attr"`
+}
+
+func (items simpleItems) toMap() map[string]string {
+	m := map[string]string{}
+	for _, item := range items {
+		m[item.Name] = item.Value
+	}
+	return m
+}
+
+// Subscribe creates a PullPoint subscription, which the device ends after the termination time unless renewed
+func (c *Client) Subscribe(ctx context.Context, termination time.Duration) (*Subscription, error) {
+	eventsURL, err := c.EventsURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Address    string `xml:"Body>CreatePullPointSubscriptionResponse>SubscriptionReference>Address"`
+		Parameters struct {
+			XML string `xml:",innerxml"`
+		} `xml:"Body>CreatePullPointSubscriptionResponse>SubscriptionReference>ReferenceParameters"`
+	}
+	body := `<CreatePullPointSubscription xmlns="` + nsEvents + `"><InitialTerminationTime>` + xsDuration(termination) +
+		`</InitialTerminationTime></CreatePullPointSubscription>`
+	if err = c.call(ctx, eventsURL, body, true, &resp); err != nil {
+		return nil, err
+	}
+	address := strings.TrimSpace(resp.Address)
+	if address == "" {
+		return nil, fmt.Errorf("ONVIF device %v gave no subscription address", c.URL)
+	}
+	return &Subscription{
+		client:              c,
+		address:             address,
+		referenceParameters: strings.TrimSpace(resp.Parameters.XML),
+	}, nil
+}
+
+// call calls the subscription, addressing it with WS-Addressing as some devices need
+func (s *Subscription) call(ctx context.Context, action string, body string, v interface{}) error {
+	header := `<Action xmlns="` + nsAddressing + `">` + action + `</Action>` +
+		`<To xmlns="` + nsAddressing + `">` + escape(s.address) + `</To>` + s.referenceParameters
+	return s.client.callWithHeader(ctx, s.address, header, body, true, v)
+}
+
+// Pull waits for event messages up to the timeout, returning as soon as there are some (or none after the timeout)
+func (s *Subscription) Pull(ctx context.Context, timeout time.Duration, limit int) ([]*Notification, error) {
+	var resp struct {
+		Messages []struct {
+			Topic   string `xml:"Topic"`
+			Message struct {
+				UtcTime   string      `xml:"UtcTime,attr"`
+				Operation string      `xml:"PropertyOperation,attr"`
+				Source    simpleItems `xml:"Source>SimpleItem"`
+				Data      simpleItems `xml:"Data>SimpleItem"`
+			} `xml:"Message>Message"`
+		} `xml:"Body>PullMessagesResponse>NotificationMessage"`
+	}
+	body := `<PullMessages xmlns="` + nsEvents + `"><Timeout>` + xsDuration(timeout) + `</Timeout>` +
+		`<MessageLimit>` + strconv.Itoa(limit) + `</MessageLimit></PullMessages>`
+	// The device holds the request for up to the timeout
+	ctx, cancel := context.WithTimeout(ctx, timeout+requestTimeout)
+	defer cancel()
+	if err := s.call(ctx, nsEvents+"/PullPointSubscription/PullMessagesRequest", body, &resp); err != nil {
+		return nil, err
+	}
+	var notifications []*Notification
+	for _, m := range resp.Messages {
+		n := &Notification{
+			Topic:     strings.TrimSpace(m.Topic),
+			Operation: m.Message.Operation,
+			Source:    m.Message.Source.toMap(),
+			Data:      m.Message.Data.toMap(),
+		}
+		n.Time, _ = time.Parse(time.RFC3339, m.Message.UtcTime)
+		notifications = append(notifications, n)
+	}
+	return notifications, nil
+}
+
+// Renew extends the subscription for the termination time from now
+func (s *Subscription) Renew(ctx context.Context, termination time.Duration) error {
+	var resp struct{}
+	body := `<Renew xmlns="` + nsNotify + `"><TerminationTime>` + xsDuration(termination) + `</TerminationTime></Renew>`
+	return s.call(ctx, nsNotify+"/SubscriptionManager/RenewRequest", body, &resp)
+}
+
+func (s *Subscription) Unsubscribe(ctx context.Context) error {
+	var resp struct{}
+	return s.call(ctx, nsNotify+"/SubscriptionManager/UnsubscribeRequest", `<Unsubscribe xmlns="`+nsNotify+`"/>`, &resp)
+}
+
+// xsDuration formats the duration as xs:duration, e.g. PT60S
+func xsDuration(d time.Duration) string {
+	return fmt.Sprintf("PT%dS", int(d.Round(time.Second)/time.Second))
+}
+
+// Event topics by their last parts, most specific first
+var topicTypes = []struct {
+	part string
+	t    event.Type
+}{
+	{"People", event.Human},
+	{"Human", event.Human},
+	{"Person", event.Human},
+	{"Tamper", event.Blind},
+	{"ImageTooBlurry", event.Blind},
+	{"ImageTooDark", event.Blind},
+	{"ImageTooBright", event.Blind},
+	{"GlobalSceneChange", event.Blind},
+	{"SignalLoss", event.VideoLoss},
+	{"VideoLoss", event.VideoLoss},
+	{"DigitalInput", event.Input},
+	{"Motion", event.Motion},
+}
+
+// Type maps the topic onto the generic event types
+func (n *Notification) Type() event.Type {
+	for _, tt := range topicTypes {
+		if strings.Contains(n.Topic, tt.part) {
+			return tt.t
+		}
+	}
+	return event.Other
+}
+
+// Name is the topic without the namespace prefix, along with the rule it comes from, if any
+func (n *Notification) Name() string {
+	name := n.Topic
+	if _, after, ok := strings.Cut(name, ":"); ok {
+		name = after
+	}
+	if rule := n.Source["Rule"]; rule != "" {
+		name += " (" + rule + ")"
+	}
+	return name
+}
+
+// State tells whether the event goes on (e.g. IsMotion is true), by the first boolean data item.
+// ok is false if the message has no state, e.g. it is not about a property.
+func (n *Notification) State() (active bool, ok bool) {
+	for _, key := range []string{"IsMotion", "IsTamper", "State", "LogicalState", "IsPeople", "IsInside", "Value"} {
+		if v, found := n.Data[key]; found {
+			if b, err := strconv.ParseBool(v); err == nil {
+				return b, true
+			}
+		}
+	}
+	for _, v := range n.Data {
+		if b, err := strconv.ParseBool(v); err == nil {
+			return b, true
+		}
+	}
+	return false, false
+}
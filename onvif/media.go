@@ -0,0 +1,82 @@
+package onvif
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Profile is a media profile of the device: a stream it can give, e.g. the main and the sub one
+type Profile struct {
+	Token    string `xml:"token,attr" json:"token"`
+	Name     string `xml:"Name" json:"name"`
+	Encoding string `xml:"VideoEncoderConfiguration>Encoding" json:"encoding"`
+	Width    int    `xml:"VideoEncoderConfiguration>Resolution>Width" json:"width"`
+	Height   int    `xml:"VideoEncoderConfiguration>Resolution>Height" json:"height"`
+}
+
+// GetProfiles returns the media profiles of the device, in its own order (the main stream first, normally)
+func (c *Client) GetProfiles(ctx context.Context) ([]*Profile, error) {
+	mediaURL, err := c.MediaURL(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Profiles []*Profile `xml:"Body>GetProfilesResponse>Profiles"`
+	}
+	if err = c.call(ctx, mediaURL, `<GetProfiles xmlns="`+nsMedia+`"/>`, true, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Profiles, nil
+}
+
+// GetStreamUri returns the RTSP URI of the profile's stream (unicast)
+func (c *Client) GetStreamUri(ctx context.Context, profileToken string) (string, error) {
+	mediaURL, err := c.MediaURL(ctx)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		URI string `xml:"Body>GetStreamUriResponse>MediaUri>Uri"`
+	}
+	body := `<GetStreamUri xmlns="` + nsMedia + `"><StreamSetup>` +
+		`<Stream xmlns="` + nsSchema + `">RTP-Unicast</Stream>` +
+		`<Transport xmlns="` + nsSchema + `"><Protocol>RTSP</Protocol></Transport>` +
+		`</StreamSetup><ProfileToken>` + escape(profileToken) + `</ProfileToken></GetStreamUri>`
+	if err = c.call(ctx, mediaURL, body, true, &resp); err != nil {
+		return "", err
+	}
+	uri := strings.TrimSpace(resp.URI)
+	if uri == "" {
+		return "", fmt.Errorf("ONVIF device %v gave no URI for profile %v", c.URL, profileToken)
+	}
+	return uri, nil
+}
+
+// StreamURIs returns the RTSP URIs of the streams of the device's profiles, in order, with the credentials
+// put into them unless they have some
+func (c *Client) StreamURIs(ctx context.Context) ([]string, error) {
+	profiles, err := c.GetProfiles(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var uris []string
+	for _, p := range profiles {
+		uri, err := c.GetStreamUri(ctx, p.Token)
+		if err != nil {
+			return nil, err
+		}
+		uris = append(uris, c.withCredentials(uri))
+	}
+	return uris, nil
+}
+
+func (c *Client) withCredentials(uri string) string {
+	u, err := url.Parse(uri)
+	if err != nil || u.User != nil || c.User == "" {
+		return uri
+	}
+	u.User = url.UserPassword(c.User, c.Password)
+	return u.String()
+}
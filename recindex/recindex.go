@@ -0,0 +1,210 @@
+package recindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	bolt "go.etcd.io/bbolt"
+	"time"
+)
+
+// FileName is the name of the index database file inside BaseDir
+const FileName = "index.db"
+
+var ErrLocked = errors.New("Index database is locked (is another instance running?)")
+
+// Recording describes a single MKV chunk
+type Recording struct {
+	Camera    string        `json:"camera"`
+	Stream    string        `json:"stream"`
+	Path      string        `json:"path"` // Relative to BaseDir
+	Start     time.Time     `json:"start"`
+	End       time.Time     `json:"end"` // Zero while the chunk is still being written
+	Duration  time.Duration `json:"duration"`
+	Size      int64         `json:"size"`
+	Codec     string        `json:"codec"`
+	Keyframes int           `json:"keyframes"`
+}
+
+func (r *Recording) IsOpen() bool {
+	return r.End.IsZero()
+}
+
+// Index is an embedded database of recordings.
+// Recordings are kept in a bucket per camera, holding a nested bucket per stream,
+// keyed by the start time so that time range lookups are cursor seeks.
+type Index struct {
+	db *bolt.DB
+}
+
+// Open opens (creating if necessary) the index database at the given path.
+// isNew reports whether the database did not exist and hence needs to be rebuilt from disk.
+func Open(path string) (index *Index, isNew bool, err error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		if errors.Is(err, bolt.ErrTimeout) {
+			err = ErrLocked
+		}
+		return nil, false, err
+	}
+	err = db.View(func(tx *bolt.Tx) error {
+		isNew = tx.Bucket([]byte(metaBucket)) == nil
+		return nil
+	})
+	if err == nil && isNew {
+		err = db.Update(func(tx *bolt.Tx) error {
+			_, err := tx.CreateBucketIfNotExists([]byte(metaBucket))
+			return err
+		})
+	}
+	if err != nil {
+		db.Close()
+		return nil, false, err
+	}
+	return &Index{db: db}, isNew, nil
+}
+
+const metaBucket = "_meta"
+
+func (x *Index) Close() error {
+	return x.db.Close()
+}
+
+// Keys have a second precision, same as chunk file names, so that entries can be found by the file name alone
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.Unix()))
+	return key
+}
+
+func streamBucket(tx *bolt.Tx, cam string, stream string, create bool) (*bolt.Bucket, error) {
+	if !create {
+		cb := tx.Bucket([]byte(cam))
+		if cb == nil {
+			return nil, nil
+		}
+		return cb.Bucket([]byte(stream)), nil
+	}
+	cb, err := tx.CreateBucketIfNotExists([]byte(cam))
+	if err != nil {
+		return nil, err
+	}
+	return cb.CreateBucketIfNotExists([]byte(stream))
+}
+
+// Put adds or updates a recording
+func (x *Index) Put(r *Recording) error {
+	value, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	return x.db.Update(func(tx *bolt.Tx) error {
+		b, err := streamBucket(tx, r.Camera, r.Stream, true)
+		if err != nil {
+			return err
+		}
+		return b.Put(timeKey(r.Start), value)
+	})
+}
+
+func (x *Index) Delete(cam string, stream string, start time.Time) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		b, err := streamBucket(tx, cam, stream, false)
+		if b == nil || err != nil {
+			return err
+		}
+		return b.Delete(timeKey(start))
+	})
+}
+
+// DeleteCamera removes all recordings of the camera
+func (x *Index) DeleteCamera(cam string) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket([]byte(cam)) == nil {
+			return nil
+		}
+		return tx.DeleteBucket([]byte(cam))
+	})
+}
+
+// Query returns the recordings of the camera's stream which overlap with the [from, to) time range, oldest first.
+// Zero from or to means an open range.
+func (x *Index) Query(cam string, stream string, from time.Time, to time.Time) ([]*Recording, error) {
+	var recs []*Recording
+	err := x.db.View(func(tx *bolt.Tx) error {
+		b, err := streamBucket(tx, cam, stream, false)
+		if b == nil || err != nil {
+			return err
+		}
+		c := b.Cursor()
+		var k, v []byte
+		if from.IsZero() {
+			k, v = c.First()
+		} else {
+			fromKey := timeKey(from)
+			k, v = c.Seek(fromKey)
+			if k == nil {
+				k, v = c.Last()
+			} else if !bytes.Equal(k, fromKey) {
+				k, v = c.Prev()
+			}
+			// The chunks that started before "from" may still cover it, more than one if they overlap
+			// (e.g. a backfilled one and the next recorded one)
+			for ; k != nil; k, v = c.Prev() {
+				r := &Recording{}
+				if err := json.Unmarshal(v, r); err != nil {
+					return err
+				}
+				if !r.IsOpen() && !r.End.After(from) {
+					break
+				}
+			}
+			if k == nil {
+				k, v = c.First()
+			} else {
+				k, v = c.Next()
+			}
+		}
+		for ; k != nil; k, v = c.Next() {
+			r := &Recording{}
+			if err := json.Unmarshal(v, r); err != nil {
+				return err
+			}
+			if !to.IsZero() && !r.Start.Before(to) {
+				break
+			}
+			if !from.IsZero() && !r.IsOpen() && !r.End.After(from) {
+				continue
+			}
+			recs = append(recs, r)
+		}
+		return nil
+	})
+	return recs, err
+}
+
+// GetOpen returns the recordings that have not been closed properly e.g. because of a crash
+func (x *Index) GetOpen() ([]*Recording, error) {
+	var recs []*Recording
+	err := x.db.View(func(tx *bolt.Tx) error {
+		return tx.ForEach(func(cam []byte, cb *bolt.Bucket) error {
+			if string(cam) == metaBucket {
+				return nil
+			}
+			return cb.ForEachBucket(func(stream []byte) error {
+				return cb.Bucket(stream).ForEach(func(k, v []byte) error {
+					r := &Recording{}
+					if err := json.Unmarshal(v, r); err != nil {
+						return err
+					}
+					if r.IsOpen() {
+						recs = append(recs, r)
+					}
+					return nil
+				})
+			})
+		})
+	})
+	return recs, err
+}
@@ -0,0 +1,110 @@
+package recindex
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func openTestIndex(t *testing.T) *Index {
+	x, isNew, err := Open(filepath.Join(t.TempDir(), FileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isNew {
+		t.Fatal("A new index must be reported as such")
+	}
+	t.Cleanup(func() { x.Close() })
+	return x
+}
+
+// at is a time on the test day, by minutes and seconds since 10:00
+func at(minutes int, seconds int) time.Time {
+	return time.Date(2024, 5, 1, 10, minutes, seconds, 0, time.UTC)
+}
+
+// put indexes a recording of stream 0 of camera Gate, open if the end is zero
+func put(t *testing.T, x *Index, start time.Time, end time.Time) {
+	r := &Recording{Camera: "Gate", Stream: "0", Path: "Gate/" + start.Format(time.TimeOnly), Start: start, End: end}
+	if !end.IsZero() {
+		r.Duration = end.Sub(start)
+	}
+	if err := x.Put(r); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func starts(recs []*Recording) []string {
+	var s []string
+	for _, r := range recs {
+		s = append(s, r.Start.Format("04:05"))
+	}
+	return s
+}
+
+func TestQuery(t *testing.T) {
+	x := openTestIndex(t)
+	// Back to back chunks, a gap, then a backfilled chunk overlapping the next one, and one still being written
+	put(t, x, at(0, 0), at(10, 0))
+	put(t, x, at(10, 0), at(20, 0))
+	put(t, x, at(30, 0), at(45, 0))
+	put(t, x, at(40, 0), at(50, 0))
+	put(t, x, at(50, 0), time.Time{})
+	tests := []struct {
+		name     string
+		from, to time.Time
+		expected []string
+	}{
+		{"everything", time.Time{}, time.Time{}, []string{"00:00", "10:00", "30:00", "40:00", "50:00"}},
+		{"within a chunk", at(5, 0), at(6, 0), []string{"00:00"}},
+		{"from a chunk boundary", at(10, 0), at(15, 0), []string{"10:00"}},
+		{"to is excluded", at(5, 0), at(10, 0), []string{"00:00"}},
+		{"across chunks", at(5, 0), at(12, 0), []string{"00:00", "10:00"}},
+		{"within the gap", at(22, 0), at(28, 0), nil},
+		{"from the gap", at(25, 0), at(31, 0), []string{"30:00"}},
+		{"covered by both overlapping chunks", at(42, 0), at(43, 0), []string{"30:00", "40:00"}},
+		{"after the backfilled chunk", at(46, 0), at(47, 0), []string{"40:00"}},
+		{"the open chunk goes on", at(55, 0), time.Time{}, []string{"50:00"}},
+		{"from before the first", at(0, 0).Add(-time.Hour), at(1, 0), []string{"00:00"}},
+		{"open from", time.Time{}, at(10, 0), []string{"00:00"}},
+		{"after the open chunk started", at(59, 59).Add(time.Hour), time.Time{}, []string{"50:00"}},
+	}
+	for _, test := range tests {
+		recs, err := x.Query("Gate", "0", test.from, test.to)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := starts(recs); !slices.Equal(got, test.expected) {
+			t.Errorf("%v: expected %v, got %v", test.name, test.expected, got)
+		}
+	}
+	if recs, err := x.Query("Gate", "1", time.Time{}, time.Time{}); err != nil || len(recs) != 0 {
+		t.Errorf("Unknown stream: expected nothing, got %v, %v", recs, err)
+	}
+	if recs, err := x.Query("Porch", "0", time.Time{}, time.Time{}); err != nil || len(recs) != 0 {
+		t.Errorf("Unknown camera: expected nothing, got %v, %v", recs, err)
+	}
+}
+
+func TestOpenRecordings(t *testing.T) {
+	x := openTestIndex(t)
+	put(t, x, at(0, 0), at(10, 0))
+	put(t, x, at(10, 0), time.Time{})
+	recs, err := x.GetOpen()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := starts(recs); !slices.Equal(got, []string{"10:00"}) {
+		t.Errorf("Expected the open recording only, got %v", got)
+	}
+	// Closing it updates the entry of the same start
+	put(t, x, at(10, 0), at(20, 0))
+	if recs, err = x.GetOpen(); err != nil || len(recs) != 0 {
+		t.Errorf("Expected no open recordings, got %v, %v", starts(recs), err)
+	}
+	recs, _ = x.Query("Gate", "0", time.Time{}, time.Time{})
+	if len(recs) != 2 || recs[1].Duration != 10*time.Minute {
+		t.Errorf("Expected the closed entry in place of the open one, got %v", starts(recs))
+	}
+}
@@ -0,0 +1,299 @@
+package recindex
+
+import (
+	"fmt"
+	"github.com/greendrake/cctv/muxer/ebml/core"
+	"github.com/greendrake/cctv/muxer/ebml/matroska"
+	"github.com/greendrake/cctv/muxer/ebml/mkvcore"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const chunkTimeLayout = "2006/01/02/15-04-05"
+
+// Matches <YYYY>/<MM>/<DD>/<HH-mm-ss>.<stream>.mkv relative to the camera directory
+var chunkPathRegexp = regexp.MustCompile(`^\d{4}/\d{2}/\d{2}/\d{2}-\d{2}-\d{2}\.([^/]+)\.mkv$`)
+
+// ChunkPath returns the path of a chunk relative to the camera directory
+func ChunkPath(start time.Time, stream string) string {
+	return start.Format(chunkTimeLayout) + "." + stream + ".mkv"
+}
+
+// ParseChunkPath parses the chunk path relative to the camera directory (as made by ChunkPath)
+func ParseChunkPath(rel string) (start time.Time, stream string, ok bool) {
+	rel = filepath.ToSlash(rel)
+	m := chunkPathRegexp.FindStringSubmatch(rel)
+	if m == nil {
+		return time.Time{}, "", false
+	}
+	start, err := time.ParseInLocation(chunkTimeLayout, rel[:len(chunkTimeLayout)], time.Local)
+	if err != nil {
+		return time.Time{}, "", false
+	}
+	return start, m[1], true
+}
+
+// VideoCodecName maps Matroska codec IDs onto the names used across the app
+func VideoCodecName(codecID string) string {
+	switch codecID {
+	case core.VideoCodecMPEGHISOHEVC:
+		return "H265"
+	case core.VideoCodecMPEG4ISOAVC:
+		return "H264"
+	}
+	return codecID
+}
+
+// Probe reads all video blocks of an MKV file to find out its codec, duration and keyframe count.
+// Truncated files (e.g. left by a crash) are read as far as possible.
+func Probe(path string) (codec string, duration time.Duration, keyframes int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, 0, err
+	}
+	defer f.Close()
+	var readErr error
+	readers, err := mkvcore.NewSimpleBlockReader(f, mkvcore.WithOnFatalHandler(func(err error) {
+		readErr = err
+	}))
+	if err != nil {
+		return "", 0, 0, err
+	}
+	var video mkvcore.BlockReadCloserWithTrackEntry
+	for _, r := range readers {
+		if video == nil && r.TrackEntry().TrackType == core.TrackTypeVideo {
+			video = r
+		} else {
+			// Not reading this track, so let the reader skip its blocks
+			r.Close()
+		}
+	}
+	if video == nil {
+		return "", 0, 0, fmt.Errorf("No video track in %v", path)
+	}
+	codec = VideoCodecName(video.TrackEntry().CodecID)
+	var first, last int64 = -1, 0
+	for {
+		_, keyframe, timestamp, err := video.Read()
+		if err == io.EOF {
+			break
+		}
+		if first < 0 {
+			first = timestamp
+		}
+		last = timestamp
+		if keyframe {
+			keyframes++
+		}
+	}
+	if first >= 0 {
+		duration = time.Duration(last-first) * time.Millisecond
+	}
+	if readErr != nil && readErr != io.EOF && !strings.Contains(readErr.Error(), "EOF") {
+		log.Printf("Index: %v is damaged (%v), indexed as far as readable", path, readErr)
+	}
+	return codec, duration, keyframes, nil
+}
+
+// ProbeRecording makes a recording entry out of an existing chunk file
+func ProbeRecording(baseDir string, cam string, rel string) (*Recording, error) {
+	start, stream, ok := ParseChunkPath(rel)
+	if !ok {
+		return nil, fmt.Errorf("Not a chunk path: %v", rel)
+	}
+	path := filepath.Join(baseDir, cam, rel)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	codec, duration, keyframes, err := Probe(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Recording{
+		Camera:    cam,
+		Stream:    stream,
+		Path:      filepath.ToSlash(filepath.Join(cam, rel)),
+		Start:     start,
+		End:       start.Add(duration),
+		Duration:  duration,
+		Size:      info.Size(),
+		Codec:     codec,
+		Keyframes: keyframes,
+	}, nil
+}
+
+// Rebuild re-creates the index entries of the given cameras by scanning their chunk files.
+// Nothing may be recording meanwhile.
+func (x *Index) Rebuild(baseDir string, cams []string) error {
+	for _, cam := range cams {
+		if err := x.DeleteCamera(cam); err != nil {
+			return err
+		}
+	}
+	return x.IndexChunks(baseDir, cams, time.Time{})
+}
+
+// IndexChunks adds the chunk files of the given cameras started before the time (any if zero) to the index.
+// The chunks started from then on are left to the recorders, which index them themselves, possibly meanwhile.
+func (x *Index) IndexChunks(baseDir string, cams []string, before time.Time) error {
+	// Chunk names have second precision
+	before = before.Truncate(time.Second)
+	for _, cam := range cams {
+		camDir := filepath.Join(baseDir, cam)
+		n := 0
+		err := filepath.WalkDir(camDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == camDir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(camDir, path)
+			if err != nil {
+				return err
+			}
+			start, _, ok := ParseChunkPath(rel)
+			if !ok || (!before.IsZero() && !start.Before(before)) {
+				return nil
+			}
+			r, err := ProbeRecording(baseDir, cam, rel)
+			if err != nil {
+				log.Printf("Index: skipping %v: %v", path, err)
+				return nil
+			}
+			n++
+			return x.Put(r)
+		})
+		if err != nil {
+			return err
+		}
+		log.Printf("Index: %v chunk(s) of camera %v indexed", n, cam)
+	}
+	return nil
+}
+
+// repairChunk finalizes a chunk file left unfinalized by a crash, so that players can seek in it
+func repairChunk(path string) {
+	repaired, err := matroska.Repair(path)
+	if err != nil {
+		log.Printf("Index: cannot repair %v: %v", path, err)
+	} else if repaired {
+		log.Printf("Index: repaired %v", path)
+	}
+}
+
+// RepairChunks finalizes all unfinalized chunk files of the given cameras.
+// Only to be run when nothing is recording, as the chunks being written are unfinalized too.
+func RepairChunks(baseDir string, cams []string) error {
+	for _, cam := range cams {
+		camDir := filepath.Join(baseDir, cam)
+		err := filepath.WalkDir(camDir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if os.IsNotExist(err) && path == camDir {
+					return filepath.SkipDir
+				}
+				return err
+			}
+			if d.IsDir() {
+				return nil
+			}
+			rel, err := filepath.Rel(camDir, path)
+			if err != nil {
+				return err
+			}
+			if _, _, ok := ParseChunkPath(rel); ok {
+				repairChunk(path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepairOpen completes the entries of the chunks that were not closed properly (e.g. because of a crash)
+// by finalizing and probing the files, and removes the entries whose files are gone.
+// Only to be run before recording starts.
+func (x *Index) RepairOpen(baseDir string) error {
+	recs, err := x.GetOpen()
+	if err != nil {
+		return err
+	}
+	for _, r := range recs {
+		rel := strings.TrimPrefix(r.Path, r.Camera+"/")
+		if _, err := os.Stat(filepath.Join(baseDir, r.Path)); err == nil {
+			repairChunk(filepath.Join(baseDir, r.Path))
+		}
+		fixed, err := ProbeRecording(baseDir, r.Camera, rel)
+		if err != nil {
+			if err = x.Delete(r.Camera, r.Stream, r.Start); err != nil {
+				return err
+			}
+			continue
+		}
+		// Keep the exact start time recorded by the writer
+		fixed.Start = r.Start
+		fixed.End = r.Start.Add(fixed.Duration)
+		if err = x.Put(fixed); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ScanRange finds the camera stream's chunks overlapping with the [from, to) time range by scanning the files directly.
+// It is a fallback for when the index is not available (e.g. locked by the running service).
+func ScanRange(baseDir string, cam string, stream string, from time.Time, to time.Time) ([]*Recording, error) {
+	camDir := filepath.Join(baseDir, cam)
+	var rels []string
+	var starts []time.Time
+	err := filepath.WalkDir(camDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(camDir, path)
+		if err != nil {
+			return err
+		}
+		start, s, ok := ParseChunkPath(rel)
+		if !ok || s != stream || (!to.IsZero() && !start.Before(to)) {
+			return nil
+		}
+		rels = append(rels, rel)
+		starts = append(starts, start)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	// WalkDir goes in lexical order, which is chronological for chunk paths
+	var recs []*Recording
+	for i, rel := range rels {
+		// Skip the chunks that end before "from", i.e. the ones followed by another chunk starting not after "from"
+		if !from.IsZero() && i+1 < len(starts) && !starts[i+1].After(from) {
+			continue
+		}
+		r, err := ProbeRecording(baseDir, cam, rel)
+		if err != nil {
+			log.Printf("Index: skipping %v: %v", rel, err)
+			continue
+		}
+		if !from.IsZero() && !r.End.After(from) {
+			continue
+		}
+		recs = append(recs, r)
+	}
+	return recs, nil
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package retention
+
+import "errors"
+
+func freePercent(path string) (float64, error) {
+	return 0, errors.New("Free disk space detection is not supported on this platform")
+}
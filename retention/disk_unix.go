@@ -0,0 +1,18 @@
+//go:build unix
+
+package retention
+
+import "syscall"
+
+// freePercent returns the share of free space (available to unprivileged users)
+// on the filesystem holding the given path.
+func freePercent(path string) (float64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	if st.Blocks == 0 {
+		return 100, nil
+	}
+	return 100 * float64(st.Bavail) / float64(st.Blocks), nil
+}
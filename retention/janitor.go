@@ -0,0 +1,235 @@
+package retention
+
+import (
+	"fmt"
+	"github.com/greendrake/cctv/recindex"
+	"github.com/greendrake/cctv/util"
+	"github.com/greendrake/server_client_hierarchy"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+)
+
+const (
+	defaultInterval time.Duration = 10 * time.Minute
+	// Files modified more recently than this are assumed to be still written to and are never deleted
+	activeGuard time.Duration = 2 * time.Minute
+)
+
+// Target is a camera directory with its own retention policy
+type Target struct {
+	Name   string
+	Dir    string
+	Policy Policy
+}
+
+type chunk struct {
+	target  *Target
+	path    string
+	stream  string
+	start   time.Time
+	size    int64
+	active  bool
+	deleted bool
+}
+
+// Janitor periodically deletes the oldest recordings to keep within the configured limits.
+// This struct is client to CCTV.
+type Janitor struct {
+	server_client_hierarchy.Node
+	config  Config
+	targets []*Target
+	index   *recindex.Index
+	// Share of free space on the filesystem of the path, freePercent but in tests
+	freeSpace func(path string) (float64, error)
+}
+
+// NewJanitor creates the janitor. The index is optional; if given, deleted chunks are removed from it.
+func NewJanitor(config Config, targets []*Target, index *recindex.Index) *Janitor {
+	j := &Janitor{
+		config:    config,
+		targets:   targets,
+		index:     index,
+		freeSpace: freePercent,
+	}
+	if j.config.Interval <= 0 {
+		j.config.Interval = defaultInterval
+	}
+	j.GetNode().ID = "Retention"
+	j.SetPrincipallyClient(true)
+	j.SetTask(func(ch chan bool) {
+		for {
+			j.Sweep()
+			select {
+			case <-ch:
+				return
+			case <-j.Node.Ctx.Done():
+				<-ch
+				return
+			case <-time.After(j.config.Interval):
+			}
+		}
+	})
+	return j
+}
+
+// HasAnythingToDo tells whether any limits are configured at all
+func (j *Janitor) HasAnythingToDo() bool {
+	if !j.config.IsEmpty() {
+		return true
+	}
+	for _, t := range j.targets {
+		if !t.Policy.IsEmpty() {
+			return true
+		}
+	}
+	return false
+}
+
+// Sweep enforces the per-camera limits first, and then the global ones across all cameras.
+func (j *Janitor) Sweep() {
+	var all []*chunk
+	for _, t := range j.targets {
+		chunks, err := listChunks(t)
+		if err != nil {
+			log.Printf("Retention: cannot list recordings of %v: %v", t.Name, err)
+			continue
+		}
+		maxAge := t.Policy.MaxAge
+		if maxAge == 0 {
+			maxAge = j.config.MaxAge
+		}
+		j.enforceMaxAge(chunks, maxAge)
+		j.enforceMaxBytes(chunks, t.Policy.MaxBytes)
+		j.enforceMinFree(chunks, t.Policy.MinFreePercent)
+		all = append(all, chunks...)
+	}
+	slices.SortStableFunc(all, func(a, b *chunk) int {
+		return a.start.Compare(b.start)
+	})
+	j.enforceMaxBytes(all, j.config.MaxBytes)
+	j.enforceMinFree(all, j.config.MinFreePercent)
+}
+
+func (j *Janitor) enforceMaxAge(chunks []*chunk, maxAge time.Duration) {
+	if maxAge <= 0 {
+		return
+	}
+	threshold := time.Now().Add(-maxAge)
+	for _, c := range chunks {
+		if c.start.After(threshold) {
+			break
+		}
+		j.delete(c, "older than "+maxAge.String())
+	}
+}
+
+func (j *Janitor) enforceMaxBytes(chunks []*chunk, maxBytes util.ByteSize) {
+	if maxBytes <= 0 {
+		return
+	}
+	var total int64
+	for _, c := range chunks {
+		if !c.deleted {
+			total += c.size
+		}
+	}
+	for _, c := range chunks {
+		if total <= int64(maxBytes) {
+			break
+		}
+		if j.delete(c, "total size exceeds "+maxBytes.String()) {
+			total -= c.size
+		}
+	}
+}
+
+func (j *Janitor) enforceMinFree(chunks []*chunk, minFreePercent float64) {
+	if minFreePercent <= 0 {
+		return
+	}
+	for _, c := range chunks {
+		free, err := j.freeSpace(c.target.Dir)
+		if err != nil {
+			log.Printf("Retention: cannot get free disk space of %v: %v", c.target.Dir, err)
+			return
+		}
+		if free >= minFreePercent {
+			continue
+		}
+		j.delete(c, fmt.Sprintf("free disk space below %v%%", minFreePercent))
+	}
+}
+
+// delete removes the chunk file along with its day, month and year directories if they become empty.
+func (j *Janitor) delete(c *chunk, reason string) bool {
+	if c.deleted || c.active {
+		return false
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		log.Printf("Retention: cannot delete %v: %v", c.path, err)
+		return false
+	}
+	c.deleted = true
+	if j.index != nil {
+		if err := j.index.Delete(c.target.Name, c.stream, c.start); err != nil {
+			log.Printf("Retention: cannot remove %v from the index: %v", c.path, err)
+		}
+	}
+	log.Printf("Retention: deleted %v (%v, %v)", c.path, util.ByteSize(c.size), reason)
+	dir := filepath.Dir(c.path)
+	for i := 0; i < 3 && dir != c.target.Dir; i++ {
+		// Fails (harmlessly) if the directory is not empty
+		if os.Remove(dir) != nil {
+			break
+		}
+		dir = filepath.Dir(dir)
+	}
+	return true
+}
+
+// listChunks returns the target's MKV chunks sorted oldest first
+func listChunks(t *Target) ([]*chunk, error) {
+	var chunks []*chunk
+	now := time.Now()
+	err := filepath.WalkDir(t.Dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == t.Dir {
+				// Nothing recorded yet
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(t.Dir, path)
+		if err != nil {
+			return err
+		}
+		start, stream, ok := recindex.ParseChunkPath(rel)
+		if !ok {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		chunks = append(chunks, &chunk{
+			target: t,
+			path:   path,
+			stream: stream,
+			start:  start,
+			size:   info.Size(),
+			active: now.Sub(info.ModTime()) < activeGuard,
+		})
+		return nil
+	})
+	slices.SortStableFunc(chunks, func(a, b *chunk) int {
+		return a.start.Compare(b.start)
+	})
+	return chunks, err
+}
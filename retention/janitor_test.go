@@ -0,0 +1,70 @@
+package retention
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/greendrake/cctv/recindex"
+)
+
+func TestSweep(t *testing.T) {
+	now := time.Now().Truncate(time.Second)
+	// Hours ago the chunks started; the last one is still being written
+	starts := []int{4, 3, 2, 1, 0}
+	tests := []struct {
+		name   string
+		policy Policy
+		// Free disk space to begin with, each deleted chunk adding 10%
+		free float64
+		// Hours ago the chunks left started
+		left []int
+	}{
+		{"no limits", Policy{}, 0, []int{4, 3, 2, 1, 0}},
+		{"max age", Policy{MaxAge: 150 * time.Minute}, 0, []int{2, 1, 0}},
+		{"max age of all", Policy{MaxAge: time.Minute}, 0, []int{0}},
+		{"max bytes", Policy{MaxBytes: 3000}, 0, []int{2, 1, 0}},
+		{"max bytes below", Policy{MaxBytes: 2500}, 0, []int{1, 0}},
+		{"min free", Policy{MinFreePercent: 25}, 5, []int{2, 1, 0}},
+		{"min free already", Policy{MinFreePercent: 25}, 30, []int{4, 3, 2, 1, 0}},
+		{"min free never", Policy{MinFreePercent: 99}, 0, []int{0}},
+		{"age then free", Policy{MaxAge: 210 * time.Minute, MinFreePercent: 25}, 0, []int{1, 0}},
+	}
+	for _, test := range tests {
+		target := &Target{Name: "cam", Dir: t.TempDir(), Policy: test.policy}
+		for _, h := range starts {
+			path := filepath.Join(target.Dir, recindex.ChunkPath(now.Add(-time.Duration(h)*time.Hour), "0"))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(path, make([]byte, 1000), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if h > 0 {
+				modified := now.Add(-time.Duration(h-1) * time.Hour).Add(-10 * time.Minute)
+				if err := os.Chtimes(path, modified, modified); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		j := NewJanitor(Config{}, []*Target{target}, nil)
+		j.freeSpace = func(path string) (float64, error) {
+			chunks, err := listChunks(target)
+			return test.free + 10*float64(len(starts)-len(chunks)), err
+		}
+		j.Sweep()
+		chunks, err := listChunks(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var left []int
+		for _, c := range chunks {
+			left = append(left, int(now.Sub(c.start).Round(time.Hour)/time.Hour))
+		}
+		if !slices.Equal(left, test.left) {
+			t.Errorf("%v: expected chunks of %v hours ago left, got %v", test.name, test.left, left)
+		}
+	}
+}
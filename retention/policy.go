@@ -0,0 +1,23 @@
+package retention
+
+import (
+	"github.com/greendrake/cctv/util"
+	"time"
+)
+
+// Policy defines the limits enforced on recordings. Zero values mean "no limit".
+type Policy struct {
+	MaxAge         time.Duration `yaml:"MaxAge"`         // Delete chunks that started longer ago than this, e.g. "720h"
+	MaxBytes       util.ByteSize `yaml:"MaxBytes"`       // Delete the oldest chunks while the total size exceeds this, e.g. "500GB"
+	MinFreePercent float64       `yaml:"MinFreePercent"` // Delete the oldest chunks while the disk has less free space than this
+}
+
+// Config is the global (top level) retention configuration.
+type Config struct {
+	Policy   `yaml:",inline"`
+	Interval time.Duration `yaml:"Interval"` // How often to enforce the limits. 10 minutes by default
+}
+
+func (p Policy) IsEmpty() bool {
+	return p.MaxAge == 0 && p.MaxBytes == 0 && p.MinFreePercent == 0
+}
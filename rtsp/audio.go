@@ -0,0 +1,96 @@
+package rtsp
+
+import (
+	"time"
+
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
+	"github.com/bluenviron/gortsplib/v4/pkg/format"
+	"github.com/bluenviron/mediacommon/pkg/codecs/mpeg4audio"
+	"github.com/greendrake/cctv/frame"
+	"github.com/pion/rtp"
+)
+
+// setupAudio sets up the first G.711 or AAC audio media found in the SDP, if any.
+// The audio frames go into the same channel as the video ones.
+func (m *Monitor) setupAudio(desc *description.Session) error {
+	var g711 *format.G711
+	var aac *format.MPEG4Audio
+	if medi := desc.FindFormat(&g711); medi != nil {
+		rtpDec, err := g711.CreateDecoder()
+		if err != nil {
+			return err
+		}
+		if _, err = m.client.Setup(desc.BaseURL, medi, 0, 0); err != nil {
+			return err
+		}
+		m.audio = &frame.AudioFormat{
+			Codec:      frame.AudioCodecPCMA,
+			SampleRate: g711.SampleRate,
+			Channels:   g711.ChannelCount,
+		}
+		if g711.MULaw {
+			m.audio.Codec = frame.AudioCodecPCMU
+		}
+		// One byte per sample per channel
+		bytesPerSecond := m.audio.SampleRate * m.audio.Channels
+		m.client.OnPacketRTP(medi, g711, func(pkt *rtp.Packet) {
+			samples, err := rtpDec.Decode(pkt)
+			if err != nil || len(samples) == 0 {
+				return
+			}
+			m.sendAudio(samples, time.Duration(len(samples))*time.Second/time.Duration(bytesPerSecond))
+		})
+		return nil
+	}
+	// LATM is not supported: its payload is not plain access units
+	if medi := desc.FindFormat(&aac); medi != nil && !aac.LATM && aac.Config != nil {
+		rtpDec, err := aac.CreateDecoder()
+		if err != nil {
+			return err
+		}
+		config, err := aac.Config.Marshal()
+		if err != nil {
+			return err
+		}
+		if _, err = m.client.Setup(desc.BaseURL, medi, 0, 0); err != nil {
+			return err
+		}
+		m.audio = &frame.AudioFormat{
+			Codec:      frame.AudioCodecAAC,
+			SampleRate: aac.Config.SampleRate,
+			Channels:   aac.Config.ChannelCount,
+			Config:     config,
+		}
+		samplesPerAU := mpeg4audio.SamplesPerAccessUnit
+		if aac.Config.FrameLengthFlag {
+			samplesPerAU = 960
+		}
+		duration := time.Duration(samplesPerAU) * time.Second / time.Duration(aac.Config.SampleRate)
+		m.client.OnPacketRTP(medi, aac, func(pkt *rtp.Packet) {
+			aus, err := rtpDec.Decode(pkt)
+			if err != nil {
+				return
+			}
+			for _, au := range aus {
+				m.sendAudio(au, duration)
+			}
+		})
+	}
+	return nil
+}
+
+func (m *Monitor) sendAudio(data []byte, duration time.Duration) {
+	f := &frame.Frame{
+		IsAudio:  true,
+		Duration: duration,
+		Data:     &data,
+	}
+	select {
+	case m.frameChannel <- f:
+	case <-m.Ctx.Done():
+	}
+}
+
+func (m *Monitor) AudioFormat() *frame.AudioFormat {
+	return m.audio
+}
@@ -1,18 +1,20 @@
 package rtsp
 
 import (
-	// "log"
 	"context"
 	"errors"
-	"time"
-	// "strings"
+	"fmt"
 	"github.com/bluenviron/gortsplib/v4"
 	"github.com/bluenviron/gortsplib/v4/pkg/base"
+	"github.com/bluenviron/gortsplib/v4/pkg/description"
 	"github.com/bluenviron/gortsplib/v4/pkg/format"
 	"github.com/bluenviron/mediacommon/pkg/codecs/h264"
 	"github.com/bluenviron/mediacommon/pkg/codecs/h265"
 	"github.com/greendrake/cctv/frame"
 	"github.com/pion/rtp"
+	"log"
+	"strings"
+	"time"
 )
 
 type Monitor struct {
@@ -22,12 +24,41 @@ type Monitor struct {
 	vps          []byte
 	sps          []byte
 	pps          []byte
+	// Format of the audio frames, nil if there is no audio
+	audio *frame.AudioFormat
+}
+
+// ParseTransport maps the configured transport name onto the gortsplib one. Empty means automatic (nil).
+func ParseTransport(name string) (*gortsplib.Transport, error) {
+	var t gortsplib.Transport
+	switch strings.ToLower(name) {
+	case "":
+		return nil, nil
+	case "udp":
+		t = gortsplib.TransportUDP
+	case "tcp":
+		t = gortsplib.TransportTCP
+	case "multicast", "udp-multicast":
+		t = gortsplib.TransportUDPMulticast
+	default:
+		return nil, fmt.Errorf("unknown RTSP transport %q", name)
+	}
+	return &t, nil
 }
 
-func NewMonitor(ctx context.Context, address string) (*Monitor, error) {
+// NewMonitor connects to the camera and starts playing its H264 or H265 video,
+// and the G.711 or AAC audio too if wanted and offered.
+// The transport is one of those accepted by ParseTransport.
+func NewMonitor(ctx context.Context, address string, transport string, withAudio bool) (*Monitor, error) {
+	t, err := ParseTransport(transport)
+	if err != nil {
+		// Already reported on configuration, fall back to the automatic choice
+		t = nil
+	}
 	frameChannel := make(chan *frame.Frame)
 	c := &gortsplib.Client{
 		ParentCtx: ctx,
+		Transport: t,
 		OnPacketLost: func(err error) {
 			// ignore
 		},
@@ -55,29 +86,56 @@ func NewMonitor(ctx context.Context, address string) (*Monitor, error) {
 		return nil, err
 	}
 
-	// find the H264 media and format
-	var forma *format.H265
-	medi := desc.FindFormat(&forma)
-	if medi == nil {
-		return nil, errors.New("media not found")
+	monitor := &Monitor{
+		client:       c,
+		Ctx:          ctx,
+		frameChannel: frameChannel,
 	}
 
-	// setup RTP -> H264 decoder
-	rtpDec, err := forma.CreateDecoder()
-	if err != nil {
-		return nil, err
+	// find the video media and format, whichever codec the camera offers
+	var (
+		medi   *description.Media
+		forma  format.Format
+		decode func(*rtp.Packet) ([][]byte, error)
+		build  func([][]byte, time.Duration) (*frame.Frame, error)
+	)
+	var h265Format *format.H265
+	var h264Format *format.H264
+	if medi = desc.FindFormat(&h265Format); medi != nil {
+		rtpDec, err := h265Format.CreateDecoder()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		forma, decode, build = h265Format, rtpDec.Decode, monitor.buildH265Frame
+		// Parameter sets from the SDP, in case the camera does not repeat them in-band
+		monitor.vps, monitor.sps, monitor.pps = h265Format.SafeParams()
+	} else if medi = desc.FindFormat(&h264Format); medi != nil {
+		rtpDec, err := h264Format.CreateDecoder()
+		if err != nil {
+			c.Close()
+			return nil, err
+		}
+		forma, decode, build = h264Format, rtpDec.Decode, monitor.buildH264Frame
+		monitor.sps, monitor.pps = h264Format.SafeParams()
+	} else {
+		c.Close()
+		return nil, errors.New("media not found: the camera offers neither H264 nor H265 video")
 	}
 
 	// setup a single media
 	_, err = c.Setup(desc.BaseURL, medi, 0, 0)
 	if err != nil {
-		panic(err)
+		c.Close()
+		return nil, err
 	}
 
-	monitor := &Monitor{
-		client:       c,
-		Ctx:          ctx,
-		frameChannel: frameChannel,
+	if withAudio {
+		// Audio is not worth losing the video over
+		if err = monitor.setupAudio(desc); err != nil {
+			log.Printf("Cannot set up audio of %v: %v", u.Host, err)
+			monitor.audio = nil
+		}
 	}
 
 	var prevPTS time.Duration
@@ -91,22 +149,27 @@ func NewMonitor(ctx context.Context, address string) (*Monitor, error) {
 		}
 
 		// extract access unit from RTP packets
-		au, err := rtpDec.Decode(pkt)
+		au, err := decode(pkt)
 		if err != nil {
 			return
 		}
 
-		f, err := monitor.buildH265Frame(au, pts-prevPTS)
-		prevPTS = pts
-		if err != nil {
-			panic(err)
+		f, err := build(au, pts-prevPTS)
+		if err != nil || f == nil {
+			// Nothing to show (e.g. parameter sets only), or a malformed access unit
+			return
 		}
+		prevPTS = pts
 
-		frameChannel <- f
+		select {
+		case frameChannel <- f:
+		case <-ctx.Done():
+		}
 	})
 
 	_, err = c.Play(nil)
 	if err != nil {
+		c.Close()
 		return nil, err
 	}
 
@@ -170,7 +233,7 @@ func (m *Monitor) buildH264Frame(au [][]byte, pts time.Duration) (*frame.Frame,
 	}
 
 	// add SPS and PPS before access unit that contains an IDR
-	if idrPresent {
+	if idrPresent && m.sps != nil && m.pps != nil {
 		au = append([][]byte{m.sps, m.pps}, au...)
 	}
 
@@ -223,7 +286,7 @@ func (m *Monitor) buildH265Frame(au [][]byte, pts time.Duration) (*frame.Frame,
 	}
 
 	// add VPS, SPS and PPS before random access access unit
-	if isRandomAccess {
+	if isRandomAccess && m.vps != nil && m.sps != nil && m.pps != nil {
 		au = append([][]byte{m.vps, m.sps, m.pps}, au...)
 	}
 
@@ -0,0 +1,74 @@
+package util
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ByteSize is a number of bytes that can be written in YAML either as a plain integer
+// or with a unit suffix, e.g. "500MB", "2.5GB", "1TiB".
+type ByteSize int64
+
+var byteSizeUnits = []struct {
+	suffix string
+	factor float64
+}{
+	// Longer suffixes first so that "KiB" is not mistaken for "B"
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"TIB", 1 << 40},
+	{"KB", 1e3},
+	{"MB", 1e6},
+	{"GB", 1e9},
+	{"TB", 1e12},
+	{"K", 1e3},
+	{"M", 1e6},
+	{"G", 1e9},
+	{"T", 1e12},
+	{"B", 1},
+}
+
+func ParseByteSize(s string) (ByteSize, error) {
+	str := strings.ToUpper(strings.TrimSpace(s))
+	factor := float64(1)
+	for _, u := range byteSizeUnits {
+		if strings.HasSuffix(str, u.suffix) {
+			factor = u.factor
+			str = strings.TrimSpace(strings.TrimSuffix(str, u.suffix))
+			break
+		}
+	}
+	n, err := strconv.ParseFloat(str, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid byte size: %q", s)
+	}
+	return ByteSize(n * factor), nil
+}
+
+func (b *ByteSize) UnmarshalYAML(unmarshal func(any) error) error {
+	var s string
+	if err := unmarshal(&s); err != nil {
+		return err
+	}
+	size, err := ParseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = size
+	return nil
+}
+
+func (b ByteSize) String() string {
+	const unit = 1 << 10
+	if b < unit {
+		return fmt.Sprintf("%dB", int64(b))
+	}
+	div, exp := int64(unit), 0
+	for n := int64(b) / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(b)/float64(div), "KMGTPE"[exp])
+}
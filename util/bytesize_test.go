@@ -0,0 +1,50 @@
+package util
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		s    string
+		size ByteSize
+		ok   bool
+	}{
+		{"0", 0, true},
+		{"1024", 1024, true},
+		{"500MB", 500e6, true},
+		{"2.5GB", 2.5e9, true},
+		{"1TiB", 1 << 40, true},
+		{"10 kib", 10 << 10, true},
+		{"3G", 3e9, true},
+		{" 7B ", 7, true},
+		{"1.5MiB", 3 << 19, true},
+		{"", 0, false},
+		{"MB", 0, false},
+		{"-1GB", 0, false},
+		{"12XB", 0, false},
+		{"one", 0, false},
+	}
+	for _, test := range tests {
+		size, err := ParseByteSize(test.s)
+		if (err == nil) != test.ok || size != test.size {
+			t.Errorf("ParseByteSize(%q): expected %v (ok: %v), got %v, %v", test.s, int64(test.size), test.ok, int64(size), err)
+		}
+	}
+}
+
+func TestByteSizeString(t *testing.T) {
+	tests := []struct {
+		size ByteSize
+		s    string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{1536, "1.5KiB"},
+		{5 << 30, "5.0GiB"},
+	}
+	for _, test := range tests {
+		if s := test.size.String(); s != test.s {
+			t.Errorf("ByteSize(%v): expected %q, got %q", int64(test.size), test.s, s)
+		}
+	}
+}
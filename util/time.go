@@ -0,0 +1,26 @@
+package util
+
+import (
+	"strconv"
+	"time"
+)
+
+// ParseTime accepts RFC 3339 time, local time without the zone (as sent by datetime-local inputs),
+// or Unix time in seconds. Empty value means zero time.
+func ParseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04", "2006-01-02 15:04:05"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if sec, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return time.Unix(sec, 0), nil
+	}
+	return time.Time{}, &time.ParseError{Value: s, Message: ": unsupported time format"}
+}
@@ -2,9 +2,18 @@ package util
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// Why a camera cannot do what is asked, as told to the HTTP API
+var (
+	ErrUnknownCamera  = errors.New("Unknown camera")
+	ErrNotSupported   = errors.New("Not supported by the camera")
+	ErrBusy           = errors.New("The camera is busy")
+	ErrInvalidRequest = errors.New("Invalid request")
+)
+
 func SleepCtx(ctx context.Context, delay time.Duration) bool {
 	select {
 	case <-ctx.Done():
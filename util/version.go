@@ -0,0 +1,5 @@
+package util
+
+// Version of the app, written into the recordings' metadata.
+// Set at build time with -ldflags "-X github.com/greendrake/cctv/util.Version=1.2.3"
+var Version = "dev"
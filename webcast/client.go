@@ -1,15 +1,16 @@
 package webcast
 
 import (
-	// "log"
 	// "fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/greendrake/cctv/frame"
+	"github.com/greendrake/cctv/muxer/core"
 	"github.com/greendrake/cctv/muxer/h265"
 	"github.com/greendrake/cctv/muxer/mp4"
 	"github.com/greendrake/server_client_hierarchy"
 	"golang.org/x/net/websocket"
+	"log"
 	"sync"
 	"time"
 )
@@ -20,10 +21,11 @@ const (
 )
 
 // Client is a principally client Node.
-// It runs standalone initially, and, upon establishing connection with the browser, it attaches as a client to the Caster.
+// It runs standalone initially, and, upon establishing connection with the browser, it attaches as a client to the Caster
+// (or Player, when replaying recorded footage).
 type Client struct {
 	server_client_hierarchy.Node
-	caster             *Caster
+	server             server_client_hierarchy.NodeInterface
 	wsReadyChannel     chan bool
 	stopCommandChannel chan bool
 	ws                 *websocket.Conn
@@ -39,13 +41,13 @@ type Client struct {
 // Probably because of packet ordinal sequence numbers or something, dunno exactly.
 // Otherwise muxer could sit in the Caster, and each Client would just pass []byte payload to the browsers.
 
-func NewClient(c *gin.Context, caster *Caster) *Client {
+func NewClient(c *gin.Context, server server_client_hierarchy.NodeInterface) *Client {
 	client := &Client{
-		caster:         caster,
+		server:         server,
 		wsReadyChannel: make(chan bool),
 		trackID:        byte(0),
 	}
-	client.GetNode().ID = "Client " + uuid.New().String() + ", caster " + caster.GetNode().ID
+	client.GetNode().ID = "Client " + uuid.New().String() + ", server " + server.GetNode().ID
 	client.GetNode().AllowAbruptStop = true // When stopping browser clients, no need to wait for any queues to flush or anything, just cut them
 	client.SetPrincipallyClient(true)
 	client.SetTask(func(ch chan bool) {
@@ -54,7 +56,7 @@ func NewClient(c *gin.Context, caster *Caster) *Client {
 		handler.ServeHTTP(c.Writer, c.Request)
 	})
 	client.SetIChunkHandler(client.videoChunkHandler)
-	caster.AddClient(client) // client will start receiving frames from the caster now. They will build up in the queue until the muxer is populated
+	server.AddClient(client) // client will start receiving frames from the server now. They will build up in the queue until the muxer is populated
 	// log.Printf("Creating webcast client %v", client.GetNode().ID)
 	// client.On("stop", func(args ...any) {
 	// 	log.Printf("Stopped webcast client %v", client.GetNode().ID)
@@ -71,10 +73,20 @@ func (c *Client) videoChunkHandler(chunk any) {
 	payload := h265.EncodeToAVCC(*f.Data)
 	if f.IsVideoKeyFrame {
 		if !c.started {
+			codec := core.CodecH264
+			if f.IsHEVC {
+				codec = core.CodecH265
+			}
 			c.muxer = &mp4.Muxer{}
+			segment, err := c.muxer.GetInit(codec, payload, ClockRate)
+			if err != nil {
+				// Wait for a key frame with usable parameter sets
+				log.Printf("%v: %v", c.GetNode().ID, err)
+				return
+			}
 			c.wsWriteMutex.Lock()
 			c.started = true
-			c.writeToWS(c.muxer.GetInit(payload, ClockRate))
+			c.writeToWS(segment)
 		}
 	}
 	if c.started {
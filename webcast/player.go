@@ -0,0 +1,191 @@
+package webcast
+
+import (
+	"errors"
+	"fmt"
+	"github.com/greendrake/cctv/frame"
+	"github.com/greendrake/cctv/muxer/ebml/core"
+	"github.com/greendrake/cctv/muxer/ebml/mkvcore"
+	"github.com/greendrake/cctv/muxer/h265"
+	"github.com/greendrake/cctv/recindex"
+	"github.com/greendrake/server_client_hierarchy"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// How long to wait for the next chunk to appear when the end of the recorded footage is reached
+	nextChunkWait time.Duration = 5 * time.Second
+	// Used for the last frame of a chunk, which has no next frame to calculate its duration from
+	defaultFrameDuration time.Duration = 40 * time.Millisecond
+)
+
+var errPlayerStopped = errors.New("player stopped")
+
+// Player replays recorded footage of a camera stream, starting from the given time and continuing across chunks.
+// Similar to Caster, it puppet-masters webcast clients, and stops when there are none.
+type Player struct {
+	server_client_hierarchy.Node
+	index   *recindex.Index
+	baseDir string
+	cam     string
+	stream  string
+	start   time.Time
+}
+
+func NewPlayer(index *recindex.Index, baseDir string, cam string, stream string, start time.Time) *Player {
+	p := &Player{
+		index:   index,
+		baseDir: baseDir,
+		cam:     cam,
+		stream:  stream,
+		start:   start,
+	}
+	p.GetNode().ID = fmt.Sprintf("Player [%v:%v] from %v", cam, stream, start.Format(time.RFC3339))
+	p.SetTask(func(ch chan bool) {
+		err := p.play(ch)
+		if err == errPlayerStopped {
+			return
+		}
+		if err != nil && p.Node.Ctx.Err() == nil {
+			log.Printf("%v: %v", p.GetNode().ID, err)
+		}
+		// Nothing more to play, or the app is shutting down
+		go p.Stop()
+		<-ch
+	})
+	return p
+}
+
+func (p *Player) play(ch chan bool) error {
+	var last *recindex.Recording
+	from := p.start
+	waited := time.Duration(0)
+	for {
+		recs, err := p.index.Query(p.cam, p.stream, from, time.Time{})
+		if err != nil {
+			return err
+		}
+		var next *recindex.Recording
+		for _, r := range recs {
+			if last == nil || r.Start.After(last.Start) {
+				next = r
+				break
+			}
+		}
+		if next == nil {
+			if last == nil || waited >= nextChunkWait {
+				return nil
+			}
+			if err = p.sleep(ch, time.Second); err != nil {
+				return err
+			}
+			waited += time.Second
+			continue
+		}
+		waited = 0
+		var offset time.Duration
+		if last == nil && p.start.After(next.Start) {
+			offset = p.start.Sub(next.Start)
+		}
+		if err = p.playChunk(ch, next, offset); err == errPlayerStopped {
+			return err
+		} else if err != nil {
+			log.Printf("%v: cannot play %v: %v", p.GetNode().ID, next.Path, err)
+		}
+		last = next
+		from = next.Start
+	}
+}
+
+func (p *Player) sleep(ch chan bool, d time.Duration) error {
+	select {
+	case <-ch:
+		return errPlayerStopped
+	case <-p.Node.Ctx.Done():
+		return p.Node.Ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// playChunk outputs the video frames of the chunk in real time.
+// Playback starts from the key frame at or before the offset: the frames before the offset are output without delay.
+func (p *Player) playChunk(ch chan bool, rec *recindex.Recording, offset time.Duration) error {
+	f, err := os.Open(filepath.Join(p.baseDir, rec.Path))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	readers, err := mkvcore.NewSimpleBlockReader(f, mkvcore.WithOnFatalHandler(func(err error) {}))
+	if err != nil {
+		return err
+	}
+	var video mkvcore.BlockReadCloserWithTrackEntry
+	for _, r := range readers {
+		if video == nil && r.TrackEntry().TrackType == core.TrackTypeVideo {
+			video = r
+		} else {
+			r.Close()
+		}
+	}
+	if video == nil {
+		return errors.New("no video track")
+	}
+	defer video.Close()
+	isHEVC := recindex.VideoCodecName(video.TrackEntry().CodecID) == "H265"
+	offsetMs := offset.Milliseconds()
+
+	var (
+		gop              []*frame.Frame // Frames since the last key frame before the offset
+		pending          *frame.Frame
+		pendingTimestamp int64
+		started          bool
+	)
+	emit := func(fr *frame.Frame, timestamp int64) error {
+		if !started {
+			if timestamp < offsetMs {
+				if fr.IsVideoKeyFrame {
+					gop = nil
+				}
+				gop = append(gop, fr)
+				return nil
+			}
+			started = true
+			for _, g := range gop {
+				p.Output(g)
+			}
+			gop = nil
+		}
+		p.Output(fr)
+		return p.sleep(ch, fr.Duration)
+	}
+	for {
+		b, keyframe, timestamp, err := video.Read()
+		if err == io.EOF {
+			break
+		}
+		if pending != nil {
+			pending.Duration = time.Duration(timestamp-pendingTimestamp) * time.Millisecond
+			if err = emit(pending, pendingTimestamp); err != nil {
+				return err
+			}
+		}
+		data := h265.EncodeToAnnexB(b)
+		pending = &frame.Frame{
+			IsVideo:         true,
+			IsHEVC:          isHEVC,
+			IsVideoKeyFrame: keyframe,
+			Data:            &data,
+		}
+		pendingTimestamp = timestamp
+	}
+	if pending != nil {
+		pending.Duration = defaultFrameDuration
+		return emit(pending, pendingTimestamp)
+	}
+	return nil
+}
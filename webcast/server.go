@@ -3,16 +3,101 @@ package webcast
 import (
 	// "log"
 	"context"
+	"errors"
 	"github.com/gin-contrib/graceful"
 	"github.com/gin-gonic/gin"
+	"github.com/greendrake/cctv/export"
+	"github.com/greendrake/cctv/recindex"
+	"github.com/greendrake/cctv/util"
 	"io"
+	"log"
+	"net/http"
+	"os"
 	"slices"
+	"strconv"
+	"time"
 )
 
-func Run(ctx context.Context, port string, sIds []string, casterGetter CasterGetter) error {
+// PTZRequest is a PTZ command, e.g. {"action":"move","movement":"left","speed":5} then {"action":"stop","movement":"left"}
+type PTZRequest struct {
+	// move, stop, setpreset, gotopreset, clearpreset, starttour or stoptour
+	Action string `json:"action"`
+	// Movement of move and stop: up, down, left, right, upleft, downleft, upright, downright,
+	// zoomin, zoomout, focusnear, focusfar, irisclose, irisopen
+	Movement string `json:"movement"`
+	// Speed of move, 1 to 8
+	Speed  int `json:"speed"`
+	Preset int `json:"preset"`
+	Tour   int `json:"tour"`
+	// Duration of move in milliseconds, after which it is stopped automatically. Without it, it goes on until stop.
+	DurationMs int `json:"duration"`
+}
+
+// DeviceInfo is what the device of a camera tells about itself
+type DeviceInfo struct {
+	System       *SystemInfo   `json:"system"`
+	Capabilities *Capabilities `json:"capabilities"`
+}
+
+// SystemInfo describes the device
+type SystemInfo struct {
+	Model     string `json:"model"`
+	SerialNo  string `json:"serialNo"`
+	Firmware  string `json:"firmware"`
+	Hardware  string `json:"hardware"`
+	BuildTime string `json:"buildTime"`
+	// Analog (local) video inputs, and digital (IP) channels of an NVR
+	VideoInChannels int `json:"videoInChannels"`
+	DigitalChannels int `json:"digitalChannels"`
+	ExtraChannels   int `json:"extraChannels"`
+	AudioInChannels int `json:"audioInChannels"`
+	AlarmInputs     int `json:"alarmInputs"`
+}
+
+// Capabilities are what the device supports
+type Capabilities struct {
+	// Stream types (Main, Extra) and video codecs (H264, H265)
+	Streams []string `json:"streams"`
+	Codecs  []string `json:"codecs"`
+	// All the functions reported, by group (e.g. EncodeFunction, AlarmFunction)
+	Functions map[string]map[string]bool `json:"functions"`
+}
+
+// PTZFunc steers the camera. Returns util.ErrUnknownCamera, util.ErrInvalidRequest or util.ErrNotSupported
+// (possibly wrapped) if it cannot.
+type PTZFunc func(cam string, r *PTZRequest) error
+
+// TriggerFunc raises an event of the camera lasting for the duration (momentary if 0).
+// Returns util.ErrUnknownCamera if there is no such camera.
+type TriggerFunc func(cam string, duration time.Duration) error
+
+// SnapshotFunc takes a JPEG picture with the camera. Returns util.ErrUnknownCamera or util.ErrNotSupported
+// (possibly wrapped) if it cannot.
+type SnapshotFunc func(cam string) ([]byte, error)
+
+// InfoFunc queries the device of the camera. Returns util.ErrUnknownCamera or util.ErrNotSupported (possibly wrapped)
+// if it cannot.
+type InfoFunc func(cam string) (*DeviceInfo, error)
+
+type Options struct {
+	Port         string
+	StreamIDs    []string // Live streams available for webcast, as "<camera>/<stream>"
+	CasterGetter CasterGetter
+	// Index of recordings and where they are. Playback is available only if the index is set.
+	Index   *recindex.Index
+	BaseDir string
+	// Camera control, optional
+	PTZ      PTZFunc
+	Trigger  TriggerFunc
+	Snapshot SnapshotFunc
+	Info     InfoFunc
+	Talk     TalkFunc
+}
+
+func Run(ctx context.Context, o *Options) error {
 	gin.SetMode(gin.ReleaseMode)
 	gin.DefaultWriter = io.Discard
-	router, err := graceful.Default(graceful.WithAddr(port))
+	router, err := graceful.Default(graceful.WithAddr(o.Port))
 	if err != nil {
 		return err
 	}
@@ -25,8 +110,8 @@ func Run(ctx context.Context, port string, sIds []string, casterGetter CasterGet
 	router.GET("/stream/:cam/:sid", func(c *gin.Context) {
 		cam := c.Param("cam")
 		sid := c.Param("sid")
-		if slices.Contains(sIds, cam+"/"+sid) {
-			caster := casterGetter(cam, sid)
+		if slices.Contains(o.StreamIDs, cam+"/"+sid) {
+			caster := o.CasterGetter(cam, sid)
 			if caster != nil { // It will be nil if there was a stream.monitorMakeMutex deadlock interrupted by app termination
 				client := NewClient(c, caster)
 				client.Start()
@@ -36,9 +121,206 @@ func Run(ctx context.Context, port string, sIds []string, casterGetter CasterGet
 			c.AbortWithStatus(404)
 		}
 	})
+
+	// List recorded chunks overlapping with the given time range
+	router.GET("/recordings/:cam/:sid", func(c *gin.Context) {
+		if o.Index == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		from, err := util.ParseTime(c.Query("from"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		to, err := util.ParseTime(c.Query("to"))
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		recs, err := o.Index.Query(c.Param("cam"), c.Param("sid"), from, to)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		if recs == nil {
+			recs = []*recindex.Recording{}
+		}
+		c.JSON(http.StatusOK, recs)
+	})
+
+	// Replay recorded footage over WebSocket the same way as live streams
+	router.GET("/playback/:cam/:sid", func(c *gin.Context) {
+		if o.Index == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		start, err := util.ParseTime(c.Query("start"))
+		if err != nil || start.IsZero() {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "start time is required"})
+			return
+		}
+		player := NewPlayer(o.Index, o.BaseDir, c.Param("cam"), c.Param("sid"), start)
+		player.SetContext(ctx)
+		client := NewClient(c, player)
+		client.Start()
+		client.Wait()
+	})
+
+	// Cut the time range out of the recordings into a single downloadable MKV or MP4 file
+	router.GET("/export/:cam/:sid", func(c *gin.Context) {
+		if o.Index == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		from, err1 := util.ParseTime(c.Query("from"))
+		to, err2 := util.ParseTime(c.Query("to"))
+		if err1 != nil || err2 != nil || from.IsZero() || to.IsZero() || !to.After(from) {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "valid from and to times are required"})
+			return
+		}
+		format := c.DefaultQuery("format", export.FormatMKV)
+		if format != export.FormatMKV && format != export.FormatMP4 {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "format must be mkv or mp4"})
+			return
+		}
+		cam, sid := c.Param("cam"), c.Param("sid")
+		recs, err := o.Index.Query(cam, sid, from, to)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		f, err := os.CreateTemp("", "cctv-export-*."+format)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer os.Remove(f.Name())
+		err = export.Export(o.BaseDir, recs, from, to, format, f)
+		f.Close()
+		if err == export.ErrNoFootage {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			log.Printf("Export of %v/%v failed: %v", cam, sid, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.FileAttachment(f.Name(), export.FileName(cam, sid, from, to, format))
+	})
+
+	// Steer a PTZ camera, e.g. {"action":"move","movement":"left","speed":5} then {"action":"stop","movement":"left"}
+	router.POST("/ptz/:cam", func(c *gin.Context) {
+		if o.PTZ == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		var r PTZRequest
+		if err := c.ShouldBindJSON(&r); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := o.PTZ(c.Param("cam"), &r); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// What the device of the camera is and supports
+	router.GET("/cameras/:cam/info", func(c *gin.Context) {
+		if o.Info == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		info, err := o.Info(c.Param("cam"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.JSON(http.StatusOK, info)
+	})
+
+	// Take a still picture with the camera
+	router.GET("/snapshot/:cam", func(c *gin.Context) {
+		if o.Snapshot == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		jpeg, err := o.Snapshot(c.Param("cam"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.Header("Cache-Control", "no-store")
+		c.Data(http.StatusOK, "image/jpeg", jpeg)
+	})
+
+	// Raise an event of the camera, e.g. to record it in the events mode. Optional duration, e.g. "?duration=30s"
+	router.POST("/trigger/:cam", func(c *gin.Context) {
+		if o.Trigger == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		var duration time.Duration
+		if d := c.Query("duration"); d != "" {
+			var err error
+			if duration, err = time.ParseDuration(d); err != nil || duration < 0 {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid duration: " + d})
+				return
+			}
+		}
+		if err := o.Trigger(c.Param("cam"), duration); err != nil {
+			abortWithError(c, err)
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+
+	// Talk through the speaker of the camera: the browser sends microphone audio (16-bit little-endian mono PCM)
+	// over WebSocket, at the sample rate given as "?rate=48000" (8000 by default)
+	router.GET("/talk/:cam", func(c *gin.Context) {
+		if o.Talk == nil {
+			c.AbortWithStatus(http.StatusServiceUnavailable)
+			return
+		}
+		rate := talkSampleRate
+		if r := c.Query("rate"); r != "" {
+			var err error
+			if rate, err = strconv.Atoi(r); err != nil || rate < talkSampleRate {
+				c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Invalid sample rate (8000 at least): " + r})
+				return
+			}
+		}
+		t, err := o.Talk(c.Param("cam"))
+		if err != nil {
+			abortWithError(c, err)
+			return
+		}
+		serveTalk(c, t, rate)
+	})
+
 	return router.RunWithContext(ctx)
 }
 
+// abortWithError responds with the status telling why the camera could not do what was asked
+func abortWithError(c *gin.Context, err error) {
+	// The camera failed or is unreachable, unless told otherwise
+	status := http.StatusBadGateway
+	switch {
+	case errors.Is(err, util.ErrUnknownCamera):
+		status = http.StatusNotFound
+	case errors.Is(err, util.ErrInvalidRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, util.ErrNotSupported):
+		status = http.StatusNotImplemented
+	case errors.Is(err, util.ErrBusy):
+		status = http.StatusConflict
+	}
+	c.AbortWithStatusJSON(status, gin.H{"error": err.Error()})
+}
+
 // CrossOrigin Access-Control-Allow-Origin any methods
 func CrossOrigin() gin.HandlerFunc {
 	return func(c *gin.Context) {
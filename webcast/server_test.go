@@ -0,0 +1,34 @@
+package webcast
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/greendrake/cctv/util"
+)
+
+func TestAbortWithError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		err    error
+		status int
+	}{
+		{util.ErrUnknownCamera, http.StatusNotFound},
+		{fmt.Errorf("%w: unknown PTZ action", util.ErrInvalidRequest), http.StatusBadRequest},
+		{fmt.Errorf("%w: PTZ control is available over DVRIP only", util.ErrNotSupported), http.StatusNotImplemented},
+		{fmt.Errorf("%w: someone is talking through it already", util.ErrBusy), http.StatusConflict},
+		{errors.New("connection refused"), http.StatusBadGateway},
+	}
+	for _, test := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		abortWithError(c, test.err)
+		if w.Code != test.status {
+			t.Errorf("%v: expected %v, got %v", test.err, test.status, w.Code)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package webcast
+
+import (
+	"encoding/binary"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+	"log"
+)
+
+// Talker plays audio through the speaker of a camera
+type Talker interface {
+	// Send plays G.711 A-law audio, 8 kHz mono
+	Send(alaw []byte) error
+	Close()
+}
+
+// TalkFunc claims the speaker of the camera. Returns util.ErrUnknownCamera, util.ErrNotSupported or util.ErrBusy
+// (possibly wrapped) if it cannot.
+type TalkFunc func(cam string) (Talker, error)
+
+// The sample rate the cameras play
+const talkSampleRate = 8000
+
+// serveTalk plays the microphone audio sent by the browser over the WebSocket (binary messages of 16-bit little-endian
+// mono PCM at the sample rate given) through the talker, until the browser disconnects
+func serveTalk(c *gin.Context, t Talker, sampleRate int) {
+	defer t.Close()
+	websocket.Handler(func(ws *websocket.Conn) {
+		r := newResampler(sampleRate, talkSampleRate)
+		var pcm []byte
+		for {
+			if err := websocket.Message.Receive(ws, &pcm); err != nil {
+				return
+			}
+			samples := make([]int16, len(pcm)/2)
+			for i := range samples {
+				samples[i] = int16(binary.LittleEndian.Uint16(pcm[2*i:]))
+			}
+			samples = r.push(samples)
+			alaw := make([]byte, len(samples))
+			for i, s := range samples {
+				alaw[i] = encodeALaw(s)
+			}
+			if err := t.Send(alaw); err != nil {
+				log.Printf("Talkback to %v failed: %v", c.Param("cam"), err)
+				return
+			}
+		}
+	}).ServeHTTP(c.Writer, c.Request)
+}
+
+// resampler lowers the sample rate, averaging the input samples that fall into each output one
+type resampler struct {
+	ratio float64 // Input samples per output one
+	pos   float64
+	sum   float64
+	n     int
+}
+
+func newResampler(from int, to int) *resampler {
+	return &resampler{ratio: float64(from) / float64(to)}
+}
+
+func (r *resampler) push(in []int16) []int16 {
+	out := make([]int16, 0, int(float64(len(in))/r.ratio)+1)
+	for _, s := range in {
+		r.sum += float64(s)
+		r.n++
+		r.pos++
+		if r.pos >= r.ratio {
+			r.pos -= r.ratio
+			out = append(out, int16(r.sum/float64(r.n)))
+			r.sum, r.n = 0, 0
+		}
+	}
+	return out
+}
+
+// Upper bounds of the A-law segments (of 13-bit samples)
+var aLawSegmentEnds = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+
+// encodeALaw encodes the linear 16-bit sample as G.711 A-law
+func encodeALaw(sample int16) byte {
+	pcm := int(sample) >> 3
+	mask := 0xD5
+	if pcm < 0 {
+		mask = 0x55
+		pcm = -pcm - 1
+	}
+	seg := 0
+	for seg < len(aLawSegmentEnds) && pcm > aLawSegmentEnds[seg] {
+		seg++
+	}
+	if seg == len(aLawSegmentEnds) {
+		return byte(0x7F ^ mask)
+	}
+	aval := seg << 4
+	if seg < 2 {
+		aval |= (pcm >> 1) & 0x0F
+	} else {
+		aval |= (pcm >> seg) & 0x0F
+	}
+	return byte(aval ^ mask)
+}
@@ -0,0 +1,88 @@
+package webcast
+
+import (
+	"slices"
+	"testing"
+)
+
+// decodeALaw is the G.711 A-law decoder of the reference implementation (Sun Microsystems' g711.c)
+func decodeALaw(a byte) int16 {
+	a ^= 0x55
+	t := int(a&0x0F) << 4
+	switch seg := int(a&0x70) >> 4; seg {
+	case 0:
+		t += 8
+	case 1:
+		t += 0x108
+	default:
+		t += 0x108
+		t <<= seg - 1
+	}
+	if a&0x80 != 0 {
+		return int16(t)
+	}
+	return int16(-t)
+}
+
+func TestEncodeALaw(t *testing.T) {
+	// Reference values of linear2alaw()
+	tests := []struct {
+		sample int16
+		alaw   byte
+	}{
+		{0, 0xD5},
+		{-1, 0x55},
+		{8, 0xD5},
+		{16, 0xD4},
+		{-16, 0x55},
+		{1024, 0xE5},
+		{-1024, 0x7A},
+		{4095, 0x9A},
+		{32767, 0xAA},
+		{-32768, 0x2A},
+	}
+	for _, test := range tests {
+		if a := encodeALaw(test.sample); a != test.alaw {
+			t.Errorf("encodeALaw(%v): expected %#02x, got %#02x", test.sample, test.alaw, a)
+		}
+	}
+	// Every code decodes to the middle of its quantisation interval, which encodes back to the code
+	for code := 0; code < 256; code++ {
+		if a := encodeALaw(decodeALaw(byte(code))); a != byte(code) {
+			t.Errorf("encodeALaw(%v) (decoded %#02x): got %#02x", decodeALaw(byte(code)), code, a)
+		}
+	}
+}
+
+func TestResampler(t *testing.T) {
+	r := newResampler(48000, 8000)
+	in := []int16{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11}
+	if out := r.push(in); !slices.Equal(out, []int16{2, 8}) {
+		t.Errorf("Expected the averages of every 6 samples, got %v", out)
+	}
+	// The state carries over between pushes
+	r = newResampler(48000, 8000)
+	out := append(r.push(in[:4]), r.push(in[4:])...)
+	if !slices.Equal(out, []int16{2, 8}) {
+		t.Errorf("Expected the same output when pushed in parts, got %v", out)
+	}
+	// A fractional ratio gives the right number of samples over time, and a constant signal stays constant
+	r = newResampler(44100, 8000)
+	constant := make([]int16, 441)
+	for i := range constant {
+		constant[i] = -1234
+	}
+	n := 0
+	for i := 0; i < 100; i++ {
+		out := r.push(constant)
+		for _, s := range out {
+			if s != -1234 {
+				t.Fatalf("Expected -1234, got %v", s)
+			}
+		}
+		n += len(out)
+	}
+	if n < 7999 || n > 8000 {
+		t.Errorf("Expected 8000 samples out of a second at 44.1 kHz, got %v", n)
+	}
+}